@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
-	"golang.org/x/term"
 )
 
 // MattermostClient defines the interface for interacting with the Mattermost API.
@@ -21,51 +24,165 @@ type MattermostClient interface {
 type LiveClient struct {
 	client    *model.Client4
 	serverURL string
+	loggedIn  bool // a session was created by password login
 }
 
+// LiveClientOptions control how a LiveClient talks to the server.
+type LiveClientOptions struct {
+	Timeout    time.Duration // per-request timeout; zero disables it
+	MaxRetries int           // retries after the first attempt
+	TLS        TLSOptions
+	ProxyURL   string            // overrides the *_PROXY environment variables
+	Headers    map[string]string // extra headers sent with every request
+	Recorder   *Recorder         // records API exchanges for --replay; may be nil
+	Verbose    bool
+}
+
+// Defaults for LiveClientOptions.
+const (
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 3
+)
+
 // NewLiveClient creates a new LiveClient, authenticating with the provided credentials.
-func NewLiveClient(ctx context.Context, serverURL, token, username string, verbose bool) (*LiveClient, error) {
+func NewLiveClient(ctx context.Context, serverURL string, creds Credentials, opts LiveClientOptions) (*LiveClient, error) {
 	serverURL = strings.TrimRight(serverURL, "/")
+	verbose := opts.Verbose
 
+	base, err := newHTTPTransport(opts.TLS, opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TLS.InsecureSkipVerify {
+		fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification is disabled. The connection to %s can be intercepted, and credentials sent over it exposed. Do not use --insecure-skip-verify in production.\n", serverURL)
+	}
+
+	var transport http.RoundTripper = newRetryTransport(base, opts.MaxRetries, opts.Timeout, verbose)
+	if opts.Recorder != nil {
+		transport = opts.Recorder.Wrap(transport, serverURL)
+	}
 	client := model.NewAPIv4Client(serverURL)
+	client.HTTPClient = &http.Client{Transport: transport}
+	client.HTTPHeader = opts.Headers
 
-	if token != "" {
+	if creds.Token != nil {
+		token, err := creds.Token.Secret(ctx, CredentialRequest{ServerURL: serverURL})
+		if err != nil {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: failed to read token from %s", creds.Token), err)
+		}
 		client.SetToken(token)
 		if verbose {
-			fmt.Fprintln(os.Stderr, "Authenticating with personal access token...")
+			fmt.Fprintf(os.Stderr, "Authenticating with personal access token from %s...\n", creds.Token)
+		}
+	} else if creds.Username != "" {
+		source := creds.Password
+		if source == nil {
+			source = PasswordPrompt{}
 		}
-	} else if username != "" {
-		password, err := readPassword()
+		password, err := source.Secret(ctx, CredentialRequest{ServerURL: serverURL, Username: creds.Username})
 		if err != nil {
-			return nil, NewExitError(ExitConfigError, "error: failed to read password", err)
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: failed to read password from %s", source), err)
 		}
 		if verbose {
-			fmt.Fprintf(os.Stderr, "Authenticating as %s...\n", username)
+			fmt.Fprintf(os.Stderr, "Authenticating as %s...\n", creds.Username)
 		}
-		_, resp, err := client.Login(ctx, username, password)
-		if err != nil {
-			if resp != nil {
-				return nil, ClassifyAPIError(resp.StatusCode, serverURL, err)
-			}
-			return nil, ClassifyAPIError(0, serverURL, err)
+		if err := login(ctx, client, serverURL, creds, password); err != nil {
+			return nil, err
 		}
+		return &LiveClient{client: client, serverURL: serverURL, loggedIn: true}, nil
 	} else {
 		return nil, NewExitError(ExitConfigError,
-			"error: authentication required. Use --token (or MM_TOKEN) for token auth, or --username (or MM_USERNAME) for password auth.", nil)
+			"error: authentication required. Use --token (or MM_TOKEN), --token-file or --credential-helper for token auth, or --username (or MM_USERNAME) for password auth.", nil)
 	}
 
 	return &LiveClient{client: client, serverURL: serverURL}, nil
 }
 
+// mfaErrorIDs are the server error IDs for a missing or invalid MFA code.
+var mfaErrorIDs = map[string]bool{
+	"api.user.check_user_mfa.bad_code.app_error": true,
+	"mfa.validate_token.authenticate.app_error":  true,
+}
+
+// login logs in with a password. If the server asks for an MFA code, one
+// is obtained from creds.MFA and the login is retried with it.
+func login(ctx context.Context, client *model.Client4, serverURL string, creds Credentials, password string) error {
+	mfa := creds.MFA
+	if mfa == nil {
+		mfa = MFAPrompt{}
+	}
+	req := CredentialRequest{ServerURL: serverURL, Username: creds.Username}
+
+	var resp *model.Response
+	var err error
+	if creds.MFAUpfront {
+		code, codeErr := mfa.Secret(ctx, req)
+		if codeErr != nil {
+			return NewExitError(ExitConfigError, fmt.Sprintf("error: failed to read MFA code from %s", mfa), codeErr)
+		}
+		_, resp, err = client.LoginWithMFA(ctx, creds.Username, password, code)
+	} else {
+		_, resp, err = client.Login(ctx, creds.Username, password)
+		var appErr *model.AppError
+		if err != nil && errors.As(err, &appErr) && mfaErrorIDs[appErr.Id] {
+			code, codeErr := mfa.Secret(ctx, req)
+			if codeErr != nil {
+				return NewExitError(ExitConfigError, "error: this account requires multi-factor authentication. Set MM_MFA_TOKEN or run interactively to enter the code.", codeErr)
+			}
+			_, resp, err = client.LoginWithMFA(ctx, creds.Username, password, code)
+		}
+	}
+	if err != nil {
+		if resp != nil {
+			return ClassifyAPIError(resp.StatusCode, serverURL, err)
+		}
+		return ClassifyAPIError(0, serverURL, err)
+	}
+	return nil
+}
+
+// Close logs out the session created by password login, so that scheduled
+// runs do not leave sessions behind. Token authentication is unaffected.
+func (c *LiveClient) Close() error {
+	if !c.loggedIn {
+		return nil
+	}
+	// The command's context may already be cancelled; logging out should
+	// still be attempted.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.loggedIn = false
+	if _, err := c.client.Logout(ctx); err != nil {
+		return fmt.Errorf("failed to log out of %s: %w", c.serverURL, err)
+	}
+	return nil
+}
+
+// closeClient releases what a client holds, such as a login session or a
+// database connection. Failures are reported as warnings.
+func closeClient(client MattermostClient) {
+	if c, ok := client.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
+
 // GetConfig retrieves the server configuration as a generic map.
 func (c *LiveClient) GetConfig(ctx context.Context) (map[string]interface{}, error) {
-	cfg, resp, err := c.client.GetConfig(ctx)
+	return fetchConfig(ctx, c.client, c.serverURL)
+}
+
+// fetchConfig retrieves the configuration through client as a generic map.
+// The serverURL identifies the server in error messages.
+func fetchConfig(ctx context.Context, client *model.Client4, serverURL string) (map[string]interface{}, error) {
+	cfg, resp, err := client.GetConfig(ctx)
 	if err != nil {
 		statusCode := 0
 		if resp != nil {
 			statusCode = resp.StatusCode
 		}
-		return nil, ClassifyAPIError(statusCode, c.serverURL, err)
+		return nil, ClassifyAPIError(statusCode, serverURL, err)
 	}
 
 	// Convert *model.Config to map[string]interface{} via JSON round-trip.
@@ -87,29 +204,32 @@ func (c *LiveClient) ServerURL() string {
 	return c.serverURL
 }
 
-// readPassword obtains the password from an interactive prompt or environment variable.
-func readPassword() (string, error) {
-	if term.IsTerminal(int(os.Stdin.Fd())) {
-		fmt.Fprint(os.Stderr, "Password: ")
-		passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-		fmt.Fprintln(os.Stderr) // move to next line
-		if err != nil {
-			return "", fmt.Errorf("failed to read password from terminal: %w", err)
-		}
-		return string(passwordBytes), nil
+// flagOrEnv returns the flag value if non-empty, otherwise the environment variable value.
+func flagOrEnv(flagVal, envVar string) string {
+	if flagVal != "" {
+		return flagVal
 	}
+	return os.Getenv(envVar)
+}
 
-	password := os.Getenv("MM_PASSWORD")
-	if password == "" {
-		return "", fmt.Errorf("no interactive terminal available and MM_PASSWORD is not set")
+// flagOrEnvOrProfile extends flagOrEnv with a profile value, used when
+// neither the flag nor the environment variable is set.
+func flagOrEnvOrProfile(flagVal, envVar, profileVal string) string {
+	if v := flagOrEnv(flagVal, envVar); v != "" {
+		return v
 	}
-	return password, nil
+	return profileVal
 }
 
-// flagOrEnv returns the flag value if non-empty, otherwise the environment variable value.
-func flagOrEnv(flagVal, envVar string) string {
+// flagOrProfileOrEnv is flagOrEnvOrProfile with the profile value taking
+// precedence over the environment variable, for an explicitly selected
+// profile.
+func flagOrProfileOrEnv(flagVal, envVar, profileVal string) string {
 	if flagVal != "" {
 		return flagVal
 	}
+	if profileVal != "" {
+		return profileVal
+	}
 	return os.Getenv(envVar)
 }
@@ -67,3 +67,29 @@ func TestFlagOrEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagOrEnvOrProfile(t *testing.T) {
+	t.Setenv("TEST_FLAG_OR_ENV_OR_PROFILE", "from-env")
+	if got := flagOrEnvOrProfile("from-flag", "TEST_FLAG_OR_ENV_OR_PROFILE", "from-profile"); got != "from-flag" {
+		t.Errorf("flag should win, got %q", got)
+	}
+	if got := flagOrEnvOrProfile("", "TEST_FLAG_OR_ENV_OR_PROFILE", "from-profile"); got != "from-env" {
+		t.Errorf("env should win over profile, got %q", got)
+	}
+	if got := flagOrEnvOrProfile("", "TEST_FLAG_OR_ENV_OR_PROFILE_UNSET", "from-profile"); got != "from-profile" {
+		t.Errorf("profile should be the fallback, got %q", got)
+	}
+}
+
+func TestFlagOrProfileOrEnv(t *testing.T) {
+	t.Setenv("TEST_FLAG_OR_PROFILE_OR_ENV", "from-env")
+	if got := flagOrProfileOrEnv("from-flag", "TEST_FLAG_OR_PROFILE_OR_ENV", "from-profile"); got != "from-flag" {
+		t.Errorf("flag should win, got %q", got)
+	}
+	if got := flagOrProfileOrEnv("", "TEST_FLAG_OR_PROFILE_OR_ENV", "from-profile"); got != "from-profile" {
+		t.Errorf("profile should win over env, got %q", got)
+	}
+	if got := flagOrProfileOrEnv("", "TEST_FLAG_OR_PROFILE_OR_ENV", ""); got != "from-env" {
+		t.Errorf("env should be the fallback, got %q", got)
+	}
+}
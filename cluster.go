@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// ClusterStatusClient is implemented by clients that can read the cluster
+// status endpoint, which lists every node with its version and a hash of
+// the configuration it has loaded.
+type ClusterStatusClient interface {
+	ClusterStatus(ctx context.Context) ([]*model.ClusterInfo, error)
+}
+
+// ClusterStatus returns the status of each node in the cluster.
+func (c *LiveClient) ClusterStatus(ctx context.Context) ([]*model.ClusterInfo, error) {
+	return fetchClusterStatus(ctx, c.client, c.serverURL)
+}
+
+// ClusterStatus returns the status of each node in the cluster.
+func (c *LocalClient) ClusterStatus(ctx context.Context) ([]*model.ClusterInfo, error) {
+	return fetchClusterStatus(ctx, c.client, "unix://"+c.socketPath)
+}
+
+func fetchClusterStatus(ctx context.Context, client *model.Client4, serverURL string) ([]*model.ClusterInfo, error) {
+	infos, resp, err := client.GetClusterStatus(ctx)
+	if err != nil {
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		return nil, ClassifyAPIError(statusCode, serverURL, err)
+	}
+	return infos, nil
+}
+
+// ClusterNodeStatus is one node from the cluster status endpoint, marked
+// where it disagrees with the rest of the cluster.
+type ClusterNodeStatus struct {
+	ID                 string `json:"id"`
+	Hostname           string `json:"hostname"`
+	IPAddress          string `json:"ip_address"`
+	Version            string `json:"version"`
+	SchemaVersion      string `json:"schema_version,omitempty"`
+	ConfigHash         string `json:"config_hash"`
+	ConfigHashMismatch bool   `json:"config_hash_mismatch"`
+	VersionMismatch    bool   `json:"version_mismatch"`
+}
+
+// NodeConfig is a configuration fetched directly from one node.
+type NodeConfig struct {
+	Address string
+	Config  map[string]interface{}
+	Err     error
+}
+
+// NodeComparison is the comparison of one node's configuration against the
+// reference node's.
+type NodeComparison struct {
+	Node      string      `json:"node"`
+	Reference string      `json:"reference"`
+	Error     string      `json:"error,omitempty"`
+	Diff      *DiffResult `json:"diff,omitempty"`
+}
+
+// ClusterReport is the result of a cluster consistency check.
+type ClusterReport struct {
+	ServerURL   string              `json:"server_url,omitempty"`
+	ConfigHash  string              `json:"config_hash,omitempty"` // held by most nodes
+	Version     string              `json:"version,omitempty"`     // run by most nodes
+	Nodes       []ClusterNodeStatus `json:"nodes,omitempty"`
+	Comparisons []NodeComparison    `json:"comparisons,omitempty"`
+	Consistent  bool                `json:"consistent"`
+}
+
+// CheckClusterStatus marks the nodes whose config hash or version differs
+// from that of most nodes. Ties go to the value of the first node in
+// hostname order. Nodes are returned in hostname order.
+func CheckClusterStatus(infos []*model.ClusterInfo) (nodes []ClusterNodeStatus, configHash, version string) {
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		nodes = append(nodes, ClusterNodeStatus{
+			ID:            info.Id,
+			Hostname:      info.Hostname,
+			IPAddress:     info.IPAddress,
+			Version:       info.Version,
+			SchemaVersion: info.SchemaVersion,
+			ConfigHash:    info.ConfigHash,
+		})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Hostname != nodes[j].Hostname {
+			return nodes[i].Hostname < nodes[j].Hostname
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	hashes := make([]string, len(nodes))
+	versions := make([]string, len(nodes))
+	for i, n := range nodes {
+		hashes[i], versions[i] = n.ConfigHash, n.Version
+	}
+	configHash, version = mostCommon(hashes), mostCommon(versions)
+	for i := range nodes {
+		nodes[i].ConfigHashMismatch = nodes[i].ConfigHash != configHash
+		nodes[i].VersionMismatch = nodes[i].Version != version
+	}
+	return nodes, configHash, version
+}
+
+// CompareNodeConfigs compares each node's configuration against the first
+// node that could be read. Configurations should already be redacted.
+func CompareNodeConfigs(configs []NodeConfig, ignoreFields map[string]bool) []NodeComparison {
+	var reference *NodeConfig
+	for i := range configs {
+		if configs[i].Err == nil {
+			reference = &configs[i]
+			break
+		}
+	}
+
+	var comparisons []NodeComparison
+	for i := range configs {
+		node := &configs[i]
+		if node == reference {
+			continue
+		}
+		c := NodeComparison{Node: node.Address}
+		if reference != nil {
+			c.Reference = reference.Address
+		}
+		if node.Err != nil {
+			c.Error = node.Err.Error()
+			comparisons = append(comparisons, c)
+			continue
+		}
+		c.Diff = CompareConfigs(reference.Config, node.Config, ignoreFields)
+		c.Diff.Baseline = DiffSource{Source: "live", ServerURL: reference.Address, CapturedAt: "now"}
+		c.Diff.Compared = DiffSource{Source: "live", ServerURL: node.Address, CapturedAt: "now"}
+		comparisons = append(comparisons, c)
+	}
+	return comparisons
+}
+
+// NewClusterReport assembles a report and decides whether the cluster is
+// consistent: every node agrees on config hash and version, and every
+// node's configuration could be read and matches the reference node's.
+func NewClusterReport(serverURL string, infos []*model.ClusterInfo, comparisons []NodeComparison) *ClusterReport {
+	report := &ClusterReport{ServerURL: serverURL, Comparisons: comparisons, Consistent: true}
+	report.Nodes, report.ConfigHash, report.Version = CheckClusterStatus(infos)
+	for _, n := range report.Nodes {
+		if n.ConfigHashMismatch || n.VersionMismatch {
+			report.Consistent = false
+		}
+	}
+	for _, c := range comparisons {
+		if c.Error != "" || (c.Diff != nil && c.Diff.DriftDetected) {
+			report.Consistent = false
+		}
+	}
+	return report
+}
+
+// mostCommon returns the most frequent value, preferring the earliest on
+// a tie.
+func mostCommon(values []string) string {
+	counts := make(map[string]int, len(values))
+	best := ""
+	for _, v := range values {
+		counts[v]++
+		if best == "" || counts[v] > counts[best] {
+			best = v
+		}
+	}
+	return best
+}
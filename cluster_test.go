@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestCheckClusterStatus(t *testing.T) {
+	nodes, hash, version := CheckClusterStatus([]*model.ClusterInfo{
+		{Id: "c", Hostname: "app-3", Version: "10.5.0", ConfigHash: "bbb"},
+		{Id: "a", Hostname: "app-1", Version: "10.5.0", ConfigHash: "aaa"},
+		nil,
+		{Id: "b", Hostname: "app-2", Version: "10.4.1", ConfigHash: "aaa"},
+	})
+
+	if hash != "aaa" || version != "10.5.0" {
+		t.Errorf("majority hash/version = %s/%s", hash, version)
+	}
+	if len(nodes) != 3 || nodes[0].Hostname != "app-1" || nodes[2].Hostname != "app-3" {
+		t.Fatalf("nodes not sorted by hostname: %+v", nodes)
+	}
+	if nodes[0].ConfigHashMismatch || nodes[0].VersionMismatch {
+		t.Errorf("app-1 should agree with the cluster: %+v", nodes[0])
+	}
+	if !nodes[1].VersionMismatch || nodes[1].ConfigHashMismatch {
+		t.Errorf("app-2 should differ only in version: %+v", nodes[1])
+	}
+	if !nodes[2].ConfigHashMismatch || nodes[2].VersionMismatch {
+		t.Errorf("app-3 should differ only in config hash: %+v", nodes[2])
+	}
+}
+
+func TestCheckClusterStatus_TieGoesToFirstNode(t *testing.T) {
+	nodes, hash, _ := CheckClusterStatus([]*model.ClusterInfo{
+		{Hostname: "app-2", ConfigHash: "bbb"},
+		{Hostname: "app-1", ConfigHash: "aaa"},
+	})
+	if hash != "aaa" || nodes[0].ConfigHashMismatch || !nodes[1].ConfigHashMismatch {
+		t.Errorf("hash = %s, nodes = %+v", hash, nodes)
+	}
+}
+
+func TestCompareNodeConfigs(t *testing.T) {
+	config := func(maxUsers float64) map[string]interface{} {
+		return map[string]interface{}{
+			"ServiceSettings": map[string]interface{}{"SiteURL": "https://mm.example.com"},
+			"TeamSettings":    map[string]interface{}{"MaxUsersPerTeam": maxUsers},
+		}
+	}
+	comparisons := CompareNodeConfigs([]NodeConfig{
+		{Address: "https://app-1:8065", Err: errors.New("connection refused")},
+		{Address: "https://app-2:8065", Config: config(50)},
+		{Address: "https://app-3:8065", Config: config(50)},
+		{Address: "https://app-4:8065", Config: config(100)},
+	}, nil)
+
+	if len(comparisons) != 3 {
+		t.Fatalf("expected 3 comparisons, got %d", len(comparisons))
+	}
+	if comparisons[0].Node != "https://app-1:8065" || comparisons[0].Error != "connection refused" {
+		t.Errorf("unreadable node: %+v", comparisons[0])
+	}
+	for _, c := range comparisons {
+		if c.Reference != "https://app-2:8065" {
+			t.Errorf("reference = %s, want the first readable node", c.Reference)
+		}
+	}
+	if comparisons[1].Diff.DriftDetected {
+		t.Errorf("app-3 should match: %+v", comparisons[1].Diff)
+	}
+	diff := comparisons[2].Diff
+	if !diff.DriftDetected || len(diff.Changed) != 1 || diff.Changed[0].Field != "TeamSettings.MaxUsersPerTeam" {
+		t.Errorf("app-4 diff = %+v", diff)
+	}
+	if diff.Compared.ServerURL != "https://app-4:8065" || diff.Baseline.ServerURL != "https://app-2:8065" {
+		t.Errorf("diff sources = %+v / %+v", diff.Baseline, diff.Compared)
+	}
+}
+
+func TestNewClusterReport(t *testing.T) {
+	consistent := []*model.ClusterInfo{
+		{Hostname: "app-1", Version: "10.5.0", ConfigHash: "aaa"},
+		{Hostname: "app-2", Version: "10.5.0", ConfigHash: "aaa"},
+	}
+	if report := NewClusterReport("https://mm.example.com", consistent, nil); !report.Consistent {
+		t.Error("matching nodes should be consistent")
+	}
+
+	drift := []NodeComparison{{Node: "b", Reference: "a", Diff: &DiffResult{DriftDetected: true}}}
+	if report := NewClusterReport("", nil, drift); report.Consistent {
+		t.Error("a differing node config should be inconsistent")
+	}
+	unreadable := []NodeComparison{{Node: "b", Reference: "a", Error: "timeout"}}
+	if report := NewClusterReport("", nil, unreadable); report.Consistent {
+		t.Error("an unreadable node should be inconsistent")
+	}
+}
+
+func TestFormatClusterText(t *testing.T) {
+	report := NewClusterReport("https://mm.example.com", []*model.ClusterInfo{
+		{Hostname: "app-1", IPAddress: "10.0.0.1", Version: "10.5.0", ConfigHash: "aaa"},
+		{Hostname: "app-2", IPAddress: "10.0.0.2", Version: "10.5.0", ConfigHash: "bbb"},
+	}, nil)
+	out := FormatClusterText(report)
+	for _, want := range []string{
+		"! app-2",
+		"Node app-2 has config hash bbb; most nodes have aaa.",
+		"Cluster configuration is INCONSISTENT.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	empty := FormatClusterText(NewClusterReport("https://mm.example.com", nil, nil))
+	if !strings.Contains(empty, "reported no cluster nodes") {
+		t.Errorf("unexpected output for a non-clustered server:\n%s", empty)
+	}
+}
+
+func TestLiveClient_ClusterStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/cluster/status" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `[{"id":"n1","hostname":"app-1","version":"10.5.0","config_hash":"aaa","ipaddress":"10.0.0.1"}]`)
+	}))
+	defer server.Close()
+
+	creds := Credentials{Token: StaticCredential{Value: "tok"}}
+	client, err := NewLiveClient(context.Background(), server.URL, creds, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	infos, err := client.ClusterStatus(context.Background())
+	if err != nil {
+		t.Fatalf("ClusterStatus failed: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Hostname != "app-1" || infos[0].ConfigHash != "aaa" {
+		t.Errorf("infos = %+v", infos)
+	}
+}
+
+func TestLiveClient_ClusterStatusForbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"id":"api.context.permissions.app_error","status_code":403}`)
+	}))
+	defer server.Close()
+
+	creds := Credentials{Token: StaticCredential{Value: "tok"}}
+	client, _ := NewLiveClient(context.Background(), server.URL, creds, LiveClientOptions{})
+	_, err := client.ClusterStatus(context.Background())
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitAPIError {
+		t.Errorf("expected an API error, got %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// CredentialSource supplies a secret: a personal access token or a password.
+type CredentialSource interface {
+	// Secret returns the secret. The request describes what is needed, for
+	// sources such as credential helpers that serve several servers.
+	Secret(ctx context.Context, req CredentialRequest) (string, error)
+	// String describes the source for messages, without revealing the secret.
+	String() string
+}
+
+// CredentialRequest describes the credential being asked for.
+type CredentialRequest struct {
+	ServerURL string
+	Username  string // empty for a token
+}
+
+// Credentials are the sources for authenticating to a server. A token
+// takes precedence over password login.
+type Credentials struct {
+	Username string
+	Token    CredentialSource // nil unless token auth is configured
+	Password CredentialSource // nil means PasswordPrompt
+	MFA      CredentialSource // nil means MFAPrompt
+
+	// MFAUpfront sends the MFA code with the first login attempt, rather
+	// than after the server reports that one is needed.
+	MFAUpfront bool
+}
+
+// StaticCredential is a secret given directly, e.g. by --token or MM_TOKEN.
+type StaticCredential struct {
+	Value  string
+	Origin string
+}
+
+func (s StaticCredential) Secret(context.Context, CredentialRequest) (string, error) {
+	return s.Value, nil
+}
+
+func (s StaticCredential) String() string { return s.Origin }
+
+// FileCredential reads a secret from a file, which must not be readable by
+// group or others.
+type FileCredential struct {
+	Path string
+}
+
+func (f FileCredential) Secret(context.Context, CredentialRequest) (string, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read credential file %s: %w", f.Path, err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("credential file %s has permissions %04o, which allow other users to read it. Run: chmod 600 %s",
+			f.Path, info.Mode().Perm(), f.Path)
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read credential file %s: %w", f.Path, err)
+	}
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("credential file %s is empty", f.Path)
+	}
+	return secret, nil
+}
+
+func (f FileCredential) String() string { return "file " + f.Path }
+
+// ReaderCredential reads a secret from the first line of a reader, such as
+// stdin.
+type ReaderCredential struct {
+	Reader io.Reader
+	Name   string
+}
+
+func (r ReaderCredential) Secret(context.Context, CredentialRequest) (string, error) {
+	line, err := bufio.NewReader(r.Reader).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("unable to read credential from %s: %w", r.Name, err)
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("no credential received on %s", r.Name)
+	}
+	return secret, nil
+}
+
+func (r ReaderCredential) String() string { return r.Name }
+
+// HelperCredential runs a git-style credential helper. The helper is run
+// with the argument "get" and receives key=value lines describing the
+// request on stdin (protocol, host, path, username); it prints key=value
+// lines, of which password= (or token=) holds the secret.
+//
+// As with git, a helper starting with "!" is a shell command, a helper
+// containing a path separator is a program path, and any other name is
+// expanded to mm-config-diff-credential-<name>.
+type HelperCredential struct {
+	Helper string
+}
+
+func (h HelperCredential) Secret(ctx context.Context, req CredentialRequest) (string, error) {
+	var input bytes.Buffer
+	if u, err := url.Parse(req.ServerURL); err == nil {
+		fmt.Fprintf(&input, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+		if p := strings.Trim(u.Path, "/"); p != "" {
+			fmt.Fprintf(&input, "path=%s\n", p)
+		}
+	}
+	if req.Username != "" {
+		fmt.Fprintf(&input, "username=%s\n", req.Username)
+	}
+	input.WriteString("\n")
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.command()+" get")
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("credential helper %q failed: %w", h.Helper, err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), "="); ok {
+			values[key] = value
+		}
+	}
+	if req.Username == "" && values["token"] != "" {
+		return values["token"], nil
+	}
+	if values["password"] != "" {
+		return values["password"], nil
+	}
+	return "", fmt.Errorf("credential helper %q returned no credential for %s", h.Helper, req.ServerURL)
+}
+
+func (h HelperCredential) command() string {
+	switch {
+	case strings.HasPrefix(h.Helper, "!"):
+		return h.Helper[1:]
+	case strings.ContainsRune(h.Helper, '/') || strings.ContainsRune(h.Helper, os.PathSeparator):
+		return h.Helper
+	}
+	return "mm-config-diff-credential-" + h.Helper
+}
+
+func (h HelperCredential) String() string { return "credential helper " + h.Helper }
+
+// PasswordPrompt prompts for the password on an interactive terminal, and
+// otherwise falls back to the MM_PASSWORD environment variable.
+type PasswordPrompt struct{}
+
+func (PasswordPrompt) Secret(context.Context, CredentialRequest) (string, error) {
+	return readPassword()
+}
+
+func (PasswordPrompt) String() string { return "password prompt" }
+
+// readPassword obtains the password from an interactive prompt or environment variable.
+func readPassword() (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr) // move to next line
+		if err != nil {
+			return "", fmt.Errorf("failed to read password from terminal: %w", err)
+		}
+		return string(passwordBytes), nil
+	}
+
+	password := os.Getenv("MM_PASSWORD")
+	if password == "" {
+		return "", fmt.Errorf("no interactive terminal available and MM_PASSWORD is not set")
+	}
+	return password, nil
+}
+
+// MFAPrompt prompts for a multi-factor authentication code on an
+// interactive terminal.
+type MFAPrompt struct{}
+
+func (MFAPrompt) Secret(_ context.Context, req CredentialRequest) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no interactive terminal available and MM_MFA_TOKEN is not set")
+	}
+	fmt.Fprintf(os.Stderr, "MFA code for %s: ", req.Username)
+	code, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read MFA code from terminal: %w", err)
+	}
+	return strings.TrimSpace(string(code)), nil
+}
+
+func (MFAPrompt) String() string { return "MFA prompt" }
+
+// cachedCredential remembers the first secret its source returns, so that
+// a stdin or prompt source can serve several connections.
+type cachedCredential struct {
+	source CredentialSource
+	once   sync.Once
+	secret string
+	err    error
+}
+
+func (c *cachedCredential) Secret(ctx context.Context, req CredentialRequest) (string, error) {
+	c.once.Do(func() { c.secret, c.err = c.source.Secret(ctx, req) })
+	return c.secret, c.err
+}
+
+func (c *cachedCredential) String() string { return c.source.String() }
+
+// Reusable returns credentials whose sources are each consulted only once,
+// for connecting to several nodes of one cluster with the same account.
+// Credential helpers are still asked for each connection, as they answer
+// by host.
+func (c Credentials) Reusable() Credentials {
+	wrap := func(s CredentialSource) CredentialSource {
+		switch s.(type) {
+		case nil, HelperCredential:
+			return s
+		}
+		return &cachedCredential{source: s}
+	}
+	c.Token, c.Password, c.MFA = wrap(c.Token), wrap(c.Password), wrap(c.MFA)
+	return c
+}
+
+// CredentialOptions select the credential sources; see ResolveCredentials.
+type CredentialOptions struct {
+	Token            string // --token / MM_TOKEN
+	TokenFile        string
+	TokenStdin       bool
+	PasswordFile     string
+	PasswordStdin    bool
+	CredentialHelper string
+	Username         string
+	MFA              bool // prompt for the MFA code before logging in
+}
+
+// ResolveCredentials builds the credential sources from the options. A
+// token is taken from, in order: --token, a token file, stdin, or the
+// credential helper when no username is given. A password is taken from a
+// password file, stdin, the credential helper, or else PasswordPrompt. An
+// MFA code is taken from MM_MFA_TOKEN, or else MFAPrompt.
+func ResolveCredentials(opts CredentialOptions, stdin io.Reader) (Credentials, error) {
+	if opts.TokenStdin && opts.PasswordStdin {
+		return Credentials{}, NewExitError(ExitConfigError, "error: --token-stdin and --password-stdin cannot be used together.", nil)
+	}
+
+	creds := Credentials{Username: opts.Username}
+	switch {
+	case opts.Token != "":
+		creds.Token = StaticCredential{Value: opts.Token, Origin: "--token or MM_TOKEN"}
+	case opts.TokenFile != "":
+		creds.Token = FileCredential{Path: opts.TokenFile}
+	case opts.TokenStdin:
+		creds.Token = ReaderCredential{Reader: stdin, Name: "stdin"}
+	case opts.CredentialHelper != "" && opts.Username == "":
+		creds.Token = HelperCredential{Helper: opts.CredentialHelper}
+	}
+
+	switch {
+	case opts.PasswordFile != "":
+		creds.Password = FileCredential{Path: opts.PasswordFile}
+	case opts.PasswordStdin:
+		creds.Password = ReaderCredential{Reader: stdin, Name: "stdin"}
+	case opts.CredentialHelper != "":
+		creds.Password = HelperCredential{Helper: opts.CredentialHelper}
+	default:
+		creds.Password = PasswordPrompt{}
+	}
+
+	if code := os.Getenv("MM_MFA_TOKEN"); code != "" {
+		creds.MFA = StaticCredential{Value: code, Origin: "MM_MFA_TOKEN"}
+		creds.MFAUpfront = true
+	} else {
+		creds.MFA = MFAPrompt{}
+		creds.MFAUpfront = opts.MFA
+	}
+	return creds, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileCredential(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	os.WriteFile(path, []byte("s3cret-token\n"), 0600)
+
+	secret, err := FileCredential{Path: path}.Secret(context.Background(), CredentialRequest{})
+	if err != nil || secret != "s3cret-token" {
+		t.Errorf("Secret = %q, %v", secret, err)
+	}
+
+	os.Chmod(path, 0644)
+	_, err = FileCredential{Path: path}.Secret(context.Background(), CredentialRequest{})
+	if err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("expected permission error, got %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, []byte("\n"), 0600)
+	if _, err := (FileCredential{Path: empty}).Secret(context.Background(), CredentialRequest{}); err == nil {
+		t.Error("expected error for an empty file")
+	}
+	if _, err := (FileCredential{Path: filepath.Join(dir, "missing")}).Secret(context.Background(), CredentialRequest{}); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestReaderCredential(t *testing.T) {
+	secret, err := ReaderCredential{Reader: strings.NewReader("hunter2\r\nignored\n"), Name: "stdin"}.Secret(context.Background(), CredentialRequest{})
+	if err != nil || secret != "hunter2" {
+		t.Errorf("Secret = %q, %v", secret, err)
+	}
+	if _, err := (ReaderCredential{Reader: strings.NewReader(""), Name: "stdin"}).Secret(context.Background(), CredentialRequest{}); err == nil {
+		t.Error("expected error for empty input")
+	}
+}
+
+func TestHelperCredential(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "helper.sh")
+	// Echoes the request back, and answers with a secret derived from it.
+	os.WriteFile(script, []byte(`#!/bin/sh
+[ "$1" = get ] || exit 1
+while IFS= read -r line && [ -n "$line" ]; do
+  echo "$line" >> "$(dirname "$0")/request"
+  case "$line" in username=*) user="${line#username=}" ;; esac
+done
+if [ -n "$user" ]; then echo "password=pw-for-$user"; else echo "token=tok-123"; fi
+`), 0700)
+
+	ctx := context.Background()
+	secret, err := HelperCredential{Helper: script}.Secret(ctx, CredentialRequest{ServerURL: "https://mm.example.com/team"})
+	if err != nil || secret != "tok-123" {
+		t.Fatalf("token Secret = %q, %v", secret, err)
+	}
+	request, _ := os.ReadFile(filepath.Join(dir, "request"))
+	if string(request) != "protocol=https\nhost=mm.example.com\npath=team\n" {
+		t.Errorf("helper received %q", request)
+	}
+
+	secret, err = HelperCredential{Helper: "!" + script}.Secret(ctx, CredentialRequest{ServerURL: "https://mm.example.com", Username: "admin"})
+	if err != nil || secret != "pw-for-admin" {
+		t.Errorf("password Secret = %q, %v", secret, err)
+	}
+
+	if _, err := (HelperCredential{Helper: "!true"}).Secret(ctx, CredentialRequest{ServerURL: "https://mm.example.com"}); err == nil {
+		t.Error("expected error when the helper returns nothing")
+	}
+	if _, err := (HelperCredential{Helper: "!exit 1"}).Secret(ctx, CredentialRequest{ServerURL: "https://mm.example.com"}); err == nil {
+		t.Error("expected error when the helper fails")
+	}
+}
+
+func TestHelperCredential_Command(t *testing.T) {
+	tests := map[string]string{
+		"vault":               "mm-config-diff-credential-vault",
+		"/usr/local/bin/cred": "/usr/local/bin/cred",
+		"!pass show mm":       "pass show mm",
+	}
+	for helper, want := range tests {
+		if got := (HelperCredential{Helper: helper}).command(); got != want {
+			t.Errorf("command(%q) = %q, want %q", helper, got, want)
+		}
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	stdin := strings.NewReader("from-stdin\n")
+	tests := []struct {
+		name         string
+		opts         CredentialOptions
+		wantToken    string // String() of the token source, "" for none
+		wantPassword string
+	}{
+		{"token wins over file", CredentialOptions{Token: "t", TokenFile: "/f"}, "--token or MM_TOKEN", "password prompt"},
+		{"token file", CredentialOptions{TokenFile: "/f"}, "file /f", "password prompt"},
+		{"token stdin", CredentialOptions{TokenStdin: true}, "stdin", "password prompt"},
+		{"helper for token", CredentialOptions{CredentialHelper: "vault"}, "credential helper vault", "credential helper vault"},
+		{"helper for password", CredentialOptions{CredentialHelper: "vault", Username: "admin"}, "", "credential helper vault"},
+		{"password file", CredentialOptions{PasswordFile: "/p", CredentialHelper: "vault", Username: "admin"}, "", "file /p"},
+		{"password stdin", CredentialOptions{PasswordStdin: true, Username: "admin"}, "", "stdin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := ResolveCredentials(tt.opts, stdin)
+			if err != nil {
+				t.Fatalf("ResolveCredentials failed: %v", err)
+			}
+			gotToken := ""
+			if creds.Token != nil {
+				gotToken = creds.Token.String()
+			}
+			if gotToken != tt.wantToken || creds.Password.String() != tt.wantPassword {
+				t.Errorf("token = %q, password = %q", gotToken, creds.Password)
+			}
+		})
+	}
+
+	if _, err := ResolveCredentials(CredentialOptions{TokenStdin: true, PasswordStdin: true}, stdin); err == nil {
+		t.Error("expected error when both read stdin")
+	}
+}
+
+func TestNewLiveClient_PasswordFromSource(t *testing.T) {
+	var loginBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		loginBody = string(body)
+		w.Header().Set("Token", "session-token")
+		io.WriteString(w, `{"id":"u1","username":"admin"}`)
+	}))
+	defer server.Close()
+
+	creds := Credentials{Username: "admin", Password: ReaderCredential{Reader: strings.NewReader("pw\n"), Name: "stdin"}}
+	if _, err := NewLiveClient(context.Background(), server.URL, creds, LiveClientOptions{}); err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	if !strings.Contains(loginBody, `"password":"pw"`) || !strings.Contains(loginBody, `"login_id":"admin"`) {
+		t.Errorf("login body = %s", loginBody)
+	}
+}
+
+// fakeMFAServer accepts password "pw" with MFA code "123456", and records
+// login and logout calls.
+type fakeMFAServer struct {
+	logins  []map[string]string
+	logouts []string
+}
+
+func (f *fakeMFAServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v4/users/login":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		f.logins = append(f.logins, body)
+		if body["token"] != "123456" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"id":"api.user.check_user_mfa.bad_code.app_error","message":"Invalid MFA token.","status_code":401}`)
+			return
+		}
+		w.Header().Set("Token", "session-token")
+		io.WriteString(w, `{"id":"u1","username":"admin"}`)
+	case "/api/v4/users/logout":
+		f.logouts = append(f.logouts, r.Header.Get("Authorization"))
+		io.WriteString(w, `{"status":"OK"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestNewLiveClient_MFA(t *testing.T) {
+	password := StaticCredential{Value: "pw", Origin: "test"}
+	code := StaticCredential{Value: "123456", Origin: "test"}
+
+	t.Run("code requested after the server asks", func(t *testing.T) {
+		fake := &fakeMFAServer{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client, err := NewLiveClient(context.Background(), server.URL,
+			Credentials{Username: "admin", Password: password, MFA: code}, LiveClientOptions{})
+		if err != nil {
+			t.Fatalf("NewLiveClient failed: %v", err)
+		}
+		if len(fake.logins) != 2 || fake.logins[1]["token"] != "123456" {
+			t.Errorf("logins = %v", fake.logins)
+		}
+
+		if err := client.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		client.Close()
+		if len(fake.logouts) != 1 || !strings.EqualFold(fake.logouts[0], "Bearer session-token") {
+			t.Errorf("logouts = %v, want one for the session", fake.logouts)
+		}
+	})
+
+	t.Run("code sent upfront", func(t *testing.T) {
+		fake := &fakeMFAServer{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		_, err := NewLiveClient(context.Background(), server.URL,
+			Credentials{Username: "admin", Password: password, MFA: code, MFAUpfront: true}, LiveClientOptions{})
+		if err != nil {
+			t.Fatalf("NewLiveClient failed: %v", err)
+		}
+		if len(fake.logins) != 1 {
+			t.Errorf("logins = %v, want a single attempt", fake.logins)
+		}
+	})
+
+	t.Run("no code available", func(t *testing.T) {
+		server := httptest.NewServer(&fakeMFAServer{})
+		defer server.Close()
+
+		_, err := NewLiveClient(context.Background(), server.URL,
+			Credentials{Username: "admin", Password: password, MFA: FileCredential{Path: filepath.Join(t.TempDir(), "none")}}, LiveClientOptions{})
+		if err == nil || !strings.Contains(err.Error(), "multi-factor") {
+			t.Errorf("expected MFA error, got %v", err)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		server := httptest.NewServer(&fakeMFAServer{})
+		defer server.Close()
+
+		_, err := NewLiveClient(context.Background(), server.URL,
+			Credentials{Username: "admin", Password: password, MFA: StaticCredential{Value: "000000"}}, LiveClientOptions{})
+		if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("expected authentication error, got %v", err)
+		}
+	})
+}
+
+func TestLiveClient_CloseWithTokenDoesNotLogOut(t *testing.T) {
+	fake := &fakeMFAServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := NewLiveClient(context.Background(), server.URL, Credentials{Token: StaticCredential{Value: "pat"}}, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	closeClient(client)
+	if len(fake.logouts) != 0 {
+		t.Errorf("token client logged out: %v", fake.logouts)
+	}
+}
+
+func TestResolveCredentials_MFAToken(t *testing.T) {
+	t.Setenv("MM_MFA_TOKEN", "654321")
+	creds, err := ResolveCredentials(CredentialOptions{Username: "admin"}, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("ResolveCredentials failed: %v", err)
+	}
+	code, _ := creds.MFA.Secret(context.Background(), CredentialRequest{})
+	if code != "654321" || !creds.MFAUpfront {
+		t.Errorf("MFA = %q, upfront = %v", code, creds.MFAUpfront)
+	}
+}
+
+func TestCredentials_Reusable(t *testing.T) {
+	creds := Credentials{
+		Username: "admin",
+		Password: ReaderCredential{Reader: strings.NewReader("pw\n"), Name: "stdin"},
+	}.Reusable()
+
+	for i := 0; i < 2; i++ {
+		secret, err := creds.Password.Secret(context.Background(), CredentialRequest{})
+		if err != nil || secret != "pw" {
+			t.Errorf("read %d: secret = %q, err = %v", i+1, secret, err)
+		}
+	}
+	if creds.Token != nil {
+		t.Error("an unset source should stay nil")
+	}
+	if creds.Password.String() != "stdin" {
+		t.Errorf("String() = %q", creds.Password.String())
+	}
+}
+
+func TestCredentials_ReusableAsksHelperPerHost(t *testing.T) {
+	creds := Credentials{Token: HelperCredential{Helper: "!f() { sed -n 's/^host=/token=tok-/p'; }; f"}}.Reusable()
+	for _, host := range []string{"node1.example.com", "node2.example.com"} {
+		secret, err := creds.Token.Secret(context.Background(), CredentialRequest{ServerURL: "https://" + host})
+		if err != nil || secret != "tok-"+host {
+			t.Errorf("%s: secret = %q, err = %v", host, secret, err)
+		}
+	}
+}
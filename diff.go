@@ -11,7 +11,7 @@ import (
 // DiffSource describes one side of a comparison.
 type DiffSource struct {
 	File       string `json:"file,omitempty"`
-	Source     string `json:"source,omitempty"` // "file" or "live"
+	Source     string `json:"source,omitempty"` // "file", "store", "git", "s3" or "live"
 	ServerURL  string `json:"server_url,omitempty"`
 	CapturedAt string `json:"captured_at,omitempty"`
 }
@@ -35,14 +35,90 @@ type RemovedField struct {
 	Value interface{} `json:"value"`
 }
 
+// NotVisibleField records a field present on one side only because the
+// other capture's account was not permitted to read its section.
+type NotVisibleField struct {
+	Field    string      `json:"field"`
+	Value    interface{} `json:"value"`
+	HiddenIn string      `json:"hidden_in"` // "baseline" or "compared"
+}
+
 // DiffResult holds the complete comparison result.
 type DiffResult struct {
-	Baseline      DiffSource     `json:"baseline"`
-	Compared      DiffSource     `json:"compared"`
-	DriftDetected bool           `json:"drift_detected"`
-	Changed       []ChangedField `json:"changed"`
-	Added         []AddedField   `json:"added"`
-	Removed       []RemovedField `json:"removed"`
+	Baseline      DiffSource        `json:"baseline"`
+	Compared      DiffSource        `json:"compared"`
+	DriftDetected bool              `json:"drift_detected"`
+	Changed       []ChangedField    `json:"changed"`
+	Added         []AddedField      `json:"added"`
+	Removed       []RemovedField    `json:"removed"`
+	NotVisible    []NotVisibleField `json:"not_visible,omitempty"`
+
+	// Unchanged and Ignored list the other fields compared, for formats
+	// that report every field.
+	Unchanged []string `json:"-"`
+	Ignored   []string `json:"-"`
+}
+
+// DiffEntry is one changed, added or removed field of a DiffResult, in
+// the common shape the report formats render.
+type DiffEntry struct {
+	Field      string
+	ChangeType string      // "changed", "added" or "removed"
+	Before     interface{} // nil when added
+	After      interface{} // nil when removed
+}
+
+// Section returns the top-level config section of the entry's field.
+func (e DiffEntry) Section() string {
+	return configSection(e.Field)
+}
+
+// Describe summarises the change in a sentence fragment, such as
+// "ServiceSettings.EnableDeveloper changed from false to true".
+func (e DiffEntry) Describe() string {
+	switch e.ChangeType {
+	case "changed":
+		return fmt.Sprintf("%s changed from %s to %s", e.Field, FormatValue(e.Before), FormatValue(e.After))
+	case "added":
+		return fmt.Sprintf("%s was added with value %s", e.Field, FormatValue(e.After))
+	}
+	return fmt.Sprintf("%s was removed; it was %s", e.Field, FormatValue(e.Before))
+}
+
+// Entries returns the changed, added and removed fields in field order.
+func (r *DiffResult) Entries() []DiffEntry {
+	entries := make([]DiffEntry, 0, len(r.Changed)+len(r.Added)+len(r.Removed))
+	for _, c := range r.Changed {
+		entries = append(entries, DiffEntry{Field: c.Field, ChangeType: "changed", Before: c.Before, After: c.After})
+	}
+	for _, a := range r.Added {
+		entries = append(entries, DiffEntry{Field: a.Field, ChangeType: "added", After: a.Value})
+	}
+	for _, rm := range r.Removed {
+		entries = append(entries, DiffEntry{Field: rm.Field, ChangeType: "removed", Before: rm.Value})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Field < entries[j].Field
+	})
+	return entries
+}
+
+// SectionEntries are the entries of one config section.
+type SectionEntries struct {
+	Section string
+	Entries []DiffEntry
+}
+
+// GroupBySection groups field-ordered entries by config section.
+func GroupBySection(entries []DiffEntry) []SectionEntries {
+	var groups []SectionEntries
+	for _, e := range entries {
+		if n := len(groups); n == 0 || groups[n-1].Section != e.Section() {
+			groups = append(groups, SectionEntries{Section: e.Section()})
+		}
+		groups[len(groups)-1].Entries = append(groups[len(groups)-1].Entries, e)
+	}
+	return groups
 }
 
 // FlattenConfig recursively flattens a nested map into dot-notation keys.
@@ -81,10 +157,14 @@ func StripMetadata(config map[string]interface{}) map[string]interface{} {
 
 // CompareConfigs compares a baseline and target config map, returning a DiffResult.
 // Both maps are stripped of metadata and flattened before comparison.
-// Fields in the ignoreFields set are excluded.
+// Fields in the ignoreFields set are excluded. A field missing on one side
+// in a section that side's capture could not read is reported as not
+// visible rather than added or removed.
 func CompareConfigs(baseline, target map[string]interface{}, ignoreFields map[string]bool) *DiffResult {
 	baseFlat := FlattenConfig(StripMetadata(baseline), "")
 	targetFlat := FlattenConfig(StripMetadata(target), "")
+	baseVisible := sectionVisibility(baseline)
+	targetVisible := sectionVisibility(target)
 
 	result := &DiffResult{
 		Changed: []ChangedField{},
@@ -95,6 +175,7 @@ func CompareConfigs(baseline, target map[string]interface{}, ignoreFields map[st
 	// Changed and removed: iterate baseline keys
 	for k, baseVal := range baseFlat {
 		if ignoreFields[k] {
+			result.Ignored = append(result.Ignored, k)
 			continue
 		}
 		if targetVal, exists := targetFlat[k]; exists {
@@ -104,7 +185,11 @@ func CompareConfigs(baseline, target map[string]interface{}, ignoreFields map[st
 					Before: baseVal,
 					After:  targetVal,
 				})
+			} else {
+				result.Unchanged = append(result.Unchanged, k)
 			}
+		} else if !targetVisible(configSection(k)) {
+			result.NotVisible = append(result.NotVisible, NotVisibleField{Field: k, Value: baseVal, HiddenIn: "compared"})
 		} else {
 			result.Removed = append(result.Removed, RemovedField{
 				Field: k,
@@ -116,9 +201,16 @@ func CompareConfigs(baseline, target map[string]interface{}, ignoreFields map[st
 	// Added: iterate target keys not in baseline
 	for k, targetVal := range targetFlat {
 		if ignoreFields[k] {
+			if _, exists := baseFlat[k]; !exists {
+				result.Ignored = append(result.Ignored, k)
+			}
 			continue
 		}
 		if _, exists := baseFlat[k]; !exists {
+			if !baseVisible(configSection(k)) {
+				result.NotVisible = append(result.NotVisible, NotVisibleField{Field: k, Value: targetVal, HiddenIn: "baseline"})
+				continue
+			}
 			result.Added = append(result.Added, AddedField{
 				Field: k,
 				Value: targetVal,
@@ -136,6 +228,11 @@ func CompareConfigs(baseline, target map[string]interface{}, ignoreFields map[st
 	sort.Slice(result.Removed, func(i, j int) bool {
 		return result.Removed[i].Field < result.Removed[j].Field
 	})
+	sort.Slice(result.NotVisible, func(i, j int) bool {
+		return result.NotVisible[i].Field < result.NotVisible[j].Field
+	})
+	sort.Strings(result.Unchanged)
+	sort.Strings(result.Ignored)
 
 	result.DriftDetected = len(result.Changed) > 0 || len(result.Added) > 0 || len(result.Removed) > 0
 
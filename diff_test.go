@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -381,3 +382,104 @@ func TestCompareConfigs_JSONRoundTrip(t *testing.T) {
 		t.Errorf("changed field = %q", result.Changed[0].Field)
 	}
 }
+
+func TestCompareConfigs_NotVisible(t *testing.T) {
+	// The baseline was captured by a system admin; the live capture by an
+	// account that can read only ServiceSettings.
+	baseline := map[string]interface{}{
+		"ServiceSettings": map[string]interface{}{"MaximumLoginAttempts": float64(10)},
+		"SqlSettings":     map[string]interface{}{"DriverName": "postgres"},
+	}
+	target := map[string]interface{}{
+		"_metadata": map[string]interface{}{
+			"tool":             "mm-config-diff",
+			"partial":          true,
+			"visible_sections": []interface{}{"ServiceSettings"},
+		},
+		"ServiceSettings": map[string]interface{}{},
+	}
+
+	result := CompareConfigs(baseline, target, nil)
+	if len(result.NotVisible) != 1 || result.NotVisible[0].Field != "SqlSettings.DriverName" || result.NotVisible[0].HiddenIn != "compared" {
+		t.Errorf("NotVisible = %+v", result.NotVisible)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Field != "ServiceSettings.MaximumLoginAttempts" {
+		t.Errorf("a field missing from a visible section should be removed: %+v", result.Removed)
+	}
+
+	// In the other direction, fields the baseline could not read are not added.
+	reverse := CompareConfigs(target, baseline, nil)
+	if len(reverse.Added) != 1 || len(reverse.NotVisible) != 1 || reverse.NotVisible[0].HiddenIn != "baseline" {
+		t.Errorf("added = %+v, not visible = %+v", reverse.Added, reverse.NotVisible)
+	}
+}
+
+func TestCompareConfigs_NotVisibleIsNotDrift(t *testing.T) {
+	baseline := map[string]interface{}{
+		"SqlSettings": map[string]interface{}{"DriverName": "postgres"},
+	}
+	target := map[string]interface{}{
+		"_metadata": map[string]interface{}{"partial": true, "visible_sections": []interface{}{"ServiceSettings"}},
+	}
+	result := CompareConfigs(baseline, target, nil)
+	if result.DriftDetected {
+		t.Error("unreadable fields alone should not count as drift")
+	}
+}
+
+func TestCompareConfigs_NoVisibleSections(t *testing.T) {
+	baseline := map[string]interface{}{
+		"SqlSettings": map[string]interface{}{"DriverName": "postgres"},
+	}
+	target := map[string]interface{}{
+		"_metadata": map[string]interface{}{"partial": true},
+	}
+	result := CompareConfigs(baseline, target, nil)
+	if len(result.Removed) != 0 || len(result.NotVisible) != 1 {
+		t.Errorf("removed = %+v, not visible = %+v", result.Removed, result.NotVisible)
+	}
+}
+
+func TestCompareConfigs_UnchangedAndIgnored(t *testing.T) {
+	baseline := map[string]interface{}{
+		"ServiceSettings": map[string]interface{}{
+			"SiteURL":              "https://old.example.com",
+			"EnableDeveloper":      false,
+			"MaximumLoginAttempts": float64(10),
+		},
+	}
+	target := map[string]interface{}{
+		"ServiceSettings": map[string]interface{}{
+			"SiteURL":              "https://new.example.com",
+			"EnableDeveloper":      false,
+			"MaximumLoginAttempts": float64(5),
+			"ListenAddress":        ":8065",
+		},
+	}
+	ignoreFields := map[string]bool{"ServiceSettings.SiteURL": true, "ServiceSettings.ListenAddress": true}
+
+	result := CompareConfigs(baseline, target, ignoreFields)
+
+	if !reflect.DeepEqual(result.Unchanged, []string{"ServiceSettings.EnableDeveloper"}) {
+		t.Errorf("Unchanged = %v", result.Unchanged)
+	}
+	if !reflect.DeepEqual(result.Ignored, []string{"ServiceSettings.ListenAddress", "ServiceSettings.SiteURL"}) {
+		t.Errorf("Ignored = %v", result.Ignored)
+	}
+}
+
+func TestDiffEntryDescribe(t *testing.T) {
+	tests := []struct {
+		entry DiffEntry
+		want  string
+	}{
+		{DiffEntry{Field: "A.B", ChangeType: "changed", Before: float64(1), After: float64(2)}, "A.B changed from 1 to 2"},
+		{DiffEntry{Field: "A.B", ChangeType: "added", After: true}, "A.B was added with value true"},
+		{DiffEntry{Field: "A.B", ChangeType: "removed", Before: "x"}, `A.B was removed; it was "x"`},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.Describe(); got != tt.want {
+			t.Errorf("Describe() = %q, want %q", got, tt.want)
+		}
+	}
+}
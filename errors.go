@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -39,13 +41,22 @@ func NewExitError(code int, message string, err error) *ExitError {
 
 // ClassifyAPIError maps HTTP status codes and connection errors to user-facing messages.
 func ClassifyAPIError(statusCode int, serverURL string, err error) *ExitError {
+	var notRecorded *NotRecordedError
 	switch {
+	case errors.As(err, &notRecorded):
+		return NewExitError(ExitAPIError, fmt.Sprintf("error: the recording of %s has no response for %s %s. Record the command again with --record.", serverURL, notRecorded.Method, notRecorded.Path), err)
+	case errors.Is(err, context.Canceled):
+		return NewExitError(ExitAPIError, "error: operation cancelled.", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewExitError(ExitAPIError, fmt.Sprintf("error: request to %s timed out. Use --timeout to allow longer.", serverURL), err)
 	case statusCode == http.StatusUnauthorized:
 		return NewExitError(ExitAPIError, "error: authentication failed. Check your token or credentials.", err)
 	case statusCode == http.StatusForbidden:
-		return NewExitError(ExitAPIError, "error: permission denied. This operation requires a System Administrator account.", err)
+		return NewExitError(ExitAPIError, "error: permission denied. This operation requires a System Administrator account, or for reading the configuration, a role with at least one sysconsole_read permission.", err)
 	case statusCode == http.StatusNotFound:
 		return NewExitError(ExitAPIError, "error: the requested resource was not found on the server.", err)
+	case statusCode == http.StatusTooManyRequests:
+		return NewExitError(ExitAPIError, "error: the Mattermost server is rate limiting requests (HTTP 429). Try again later or use --retries.", err)
 	case statusCode >= 500:
 		return NewExitError(ExitAPIError, fmt.Sprintf("error: the Mattermost server returned an unexpected error (HTTP %d). Check server logs for details.", statusCode), err)
 	case statusCode == 0 && err != nil:
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"testing"
@@ -99,6 +101,30 @@ func TestClassifyAPIError(t *testing.T) {
 			wantCode:   ExitAPIError,
 			wantSubstr: "not found",
 		},
+		{
+			name:       "429 Too Many Requests",
+			statusCode: http.StatusTooManyRequests,
+			serverURL:  "https://mm.example.com",
+			err:        errors.New("too many requests"),
+			wantCode:   ExitAPIError,
+			wantSubstr: "rate limiting",
+		},
+		{
+			name:       "cancelled",
+			statusCode: 0,
+			serverURL:  "https://mm.example.com",
+			err:        fmt.Errorf("Get: %w", context.Canceled),
+			wantCode:   ExitAPIError,
+			wantSubstr: "cancelled",
+		},
+		{
+			name:       "timed out",
+			statusCode: 0,
+			serverURL:  "https://mm.example.com",
+			err:        fmt.Errorf("Get: %w", context.DeadlineExceeded),
+			wantCode:   ExitAPIError,
+			wantSubstr: "timed out",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
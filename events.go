@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DriftEventSchemaVersion is incremented when a DriftEvent field is
+// renamed or removed, or its meaning changes. New fields may be added
+// without a new version.
+const DriftEventSchemaVersion = 1
+
+// DriftEvent is one drifted setting, as an event for a SIEM. Every field
+// is always present; Before is null for added settings and After for
+// removed ones.
+type DriftEvent struct {
+	SchemaVersion int         `json:"schema_version"`
+	EventType     string      `json:"event_type"`
+	Timestamp     string      `json:"timestamp"`
+	RunID         string      `json:"run_id"`
+	Server        string      `json:"server"`
+	Path          string      `json:"path"`
+	Section       string      `json:"section"`
+	ChangeType    string      `json:"change_type"`
+	Severity      string      `json:"severity"`
+	Before        interface{} `json:"before"`
+	After         interface{} `json:"after"`
+	Baseline      string      `json:"baseline"`
+	Compared      string      `json:"compared"`
+}
+
+// NewRunID returns a random UUID that correlates the events of one run.
+func NewRunID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// NewDriftEvents returns an event for each drifted setting of a diff
+// result, in field order.
+func NewDriftEvents(result *DiffResult, server, runID string, now time.Time) []DriftEvent {
+	entries := result.Entries()
+	events := make([]DriftEvent, 0, len(entries))
+	for _, e := range entries {
+		events = append(events, DriftEvent{
+			SchemaVersion: DriftEventSchemaVersion,
+			EventType:     "config_drift",
+			Timestamp:     now.UTC().Format(time.RFC3339),
+			RunID:         runID,
+			Server:        server,
+			Path:          e.Field,
+			Section:       e.Section(),
+			ChangeType:    e.ChangeType,
+			Severity:      FieldSeverity(e.Field),
+			Before:        redactedValue(e.Field, e.Before),
+			After:         redactedValue(e.Field, e.After),
+			Baseline:      formatSource(result.Baseline),
+			Compared:      formatSource(result.Compared),
+		})
+	}
+	return events
+}
+
+// redactedValue redacts a value the way snapshots are redacted, so that a
+// hand-edited baseline cannot leak a secret into a SIEM.
+func redactedValue(path string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if shouldRedact(path) {
+		return RedactedValue
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		data, _ := json.Marshal(m)
+		var copied map[string]interface{}
+		json.Unmarshal(data, &copied)
+		redactMap(copied, path)
+		return copied
+	}
+	return v
+}
+
+// FormatDiffJSONLines produces one JSON object per line for each event.
+func FormatDiffJSONLines(events []DriftEvent) (string, error) {
+	var sb strings.Builder
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return "", NewExitError(ExitOutputError, "error: failed to marshal drift event to JSON", err)
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+// cefSeverity maps a field severity onto the CEF 0-10 scale.
+var cefSeverity = map[string]int{"high": 8, "medium": 5, "low": 2}
+
+// FormatDiffCEF produces one ArcSight Common Event Format line for each
+// event.
+func FormatDiffCEF(events []DriftEvent, toolVersion string) string {
+	var sb strings.Builder
+	for _, event := range events {
+		sb.WriteString(formatCEFEvent(event, toolVersion))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func formatCEFEvent(event DriftEvent, toolVersion string) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	ext := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("CEF:0|Mattermost|mm-config-diff|%s|config-%s|Configuration setting %s|%d|",
+		header.Replace(toolVersion), event.ChangeType, event.ChangeType, cefSeverity[event.Severity]))
+
+	var fields [][2]string
+	if t, err := time.Parse(time.RFC3339, event.Timestamp); err == nil {
+		fields = append(fields, [2]string{"rt", fmt.Sprint(t.UnixMilli())})
+	}
+	if u, err := url.Parse(event.Server); err == nil && u.Hostname() != "" {
+		fields = append(fields, [2]string{"dvchost", u.Hostname()})
+	}
+	fields = append(fields,
+		[2]string{"act", event.ChangeType},
+		[2]string{"cat", event.Section},
+		[2]string{"cs1Label", "path"}, [2]string{"cs1", event.Path},
+	)
+	if event.ChangeType != "added" {
+		fields = append(fields, [2]string{"cs2Label", "before"}, [2]string{"cs2", FormatValue(event.Before)})
+	}
+	if event.ChangeType != "removed" {
+		fields = append(fields, [2]string{"cs3Label", "after"}, [2]string{"cs3", FormatValue(event.After)})
+	}
+	fields = append(fields,
+		[2]string{"cs4Label", "runId"}, [2]string{"cs4", event.RunID},
+		[2]string{"cs5Label", "severity"}, [2]string{"cs5", event.Severity},
+		[2]string{"cs6Label", "server"}, [2]string{"cs6", event.Server},
+	)
+
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f[0] + "=" + ext.Replace(f[1])
+	}
+	sb.WriteString(strings.Join(parts, " "))
+	return sb.String()
+}
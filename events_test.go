@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDriftEvents(t *testing.T) {
+	now := time.Date(2025, 10, 1, 10, 0, 0, 0, time.UTC)
+	result := sampleDiffResult()
+	events := NewDriftEvents(result, "https://mm.example.com", "run-1", now)
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4", len(events))
+	}
+
+	e := events[2]
+	if e.Path != "ServiceSettings.MaximumLoginAttempts" || e.ChangeType != "changed" || e.Section != "ServiceSettings" {
+		t.Errorf("event = %+v", e)
+	}
+	if e.Timestamp != "2025-10-01T10:00:00Z" || e.RunID != "run-1" || e.Server != "https://mm.example.com" || e.SchemaVersion != 1 {
+		t.Errorf("event = %+v", e)
+	}
+	if e.Severity != FieldSeverity(e.Path) || e.Baseline != formatSource(result.Baseline) || e.Compared != formatSource(result.Compared) {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestNewDriftEvents_Redacts(t *testing.T) {
+	result := &DiffResult{
+		Changed: []ChangedField{{Field: "EmailSettings.SMTPPassword", Before: "old", After: "new"}},
+		Added:   []AddedField{{Field: "PluginSettings.Plugins.jira", Value: map[string]interface{}{"secret": "s", "enabled": true}}},
+	}
+	events := NewDriftEvents(result, "", "run-1", time.Now())
+	if events[0].Before != RedactedValue || events[0].After != RedactedValue {
+		t.Errorf("sensitive values should be redacted: %+v", events[0])
+	}
+	plugin := events[1].After.(map[string]interface{})
+	if plugin["secret"] != RedactedValue || plugin["enabled"] != true {
+		t.Errorf("nested sensitive values should be redacted: %+v", plugin)
+	}
+	if result.Added[0].Value.(map[string]interface{})["secret"] != "s" {
+		t.Error("the diff result should not be modified")
+	}
+}
+
+func TestFormatDiffJSONLines(t *testing.T) {
+	events := NewDriftEvents(sampleDiffResult(), "https://mm.example.com", "run-1", time.Now())
+	out, err := FormatDiffJSONLines(events)
+	if err != nil {
+		t.Fatalf("FormatDiffJSONLines() error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(events))
+	}
+	// Every key of the schema is present on every line.
+	keys := []string{"schema_version", "event_type", "timestamp", "run_id", "server", "path", "section", "change_type", "severity", "before", "after", "baseline", "compared"}
+	for _, line := range lines {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("line is not valid JSON: %v\n%s", err, line)
+		}
+		for _, key := range keys {
+			if _, ok := event[key]; !ok {
+				t.Errorf("event missing %q: %s", key, line)
+			}
+		}
+	}
+
+	if out, _ := FormatDiffJSONLines(nil); out != "" {
+		t.Errorf("no events should produce no output, got %q", out)
+	}
+}
+
+func TestFormatDiffCEF(t *testing.T) {
+	now := time.Date(2025, 10, 1, 10, 0, 0, 0, time.UTC)
+	events := NewDriftEvents(sampleDiffResult(), "https://mm.example.com", "run-1", now)
+	out := FormatDiffCEF(events, "1.2|3")
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), out)
+	}
+	want := `CEF:0|Mattermost|mm-config-diff|1.2\|3|config-changed|Configuration setting changed|8|` +
+		`rt=1759312800000 dvchost=mm.example.com act=changed cat=ServiceSettings cs1Label=path cs1=ServiceSettings.AllowCorsFrom ` +
+		`cs2Label=before cs2="" cs3Label=after cs3="a|b" cs4Label=runId cs4=run-1 cs5Label=severity cs5=high cs6Label=server cs6=https://mm.example.com`
+	if lines[1] != want {
+		t.Errorf("CEF line:\n got %s\nwant %s", lines[1], want)
+	}
+	if !strings.Contains(lines[0], "|config-added|") || strings.Contains(lines[0], "cs2=") {
+		t.Errorf("added events should have no before value: %s", lines[0])
+	}
+	if !strings.Contains(lines[3], "|config-removed|") || strings.Contains(lines[3], "cs3=") {
+		t.Errorf("removed events should have no after value: %s", lines[3])
+	}
+
+	escaped := formatCEFEvent(DriftEvent{ChangeType: "changed", Path: "A.B", Before: "x=y\\z", After: "line\nbreak"}, "dev")
+	if !strings.Contains(escaped, `cs2="x\=y\\\\z"`) || !strings.Contains(escaped, `cs3="line\\nbreak"`) {
+		t.Errorf("extension values should be escaped: %s", escaped)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := NewRunID(), NewRunID()
+	if !uuid.MatchString(a) {
+		t.Errorf("run ID %q is not a version 4 UUID", a)
+	}
+	if a == b {
+		t.Error("run IDs should differ")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gitSectionsDir   = "sections"
+	gitMetadataFile  = "metadata.json"
+	gitDefaultAuthor = "mm-config-diff"
+	gitDefaultEmail  = "mm-config-diff@localhost"
+)
+
+// GitHistory keeps snapshot history in a local git repository. Each top-level
+// config section is stored as its own file under sections/, with the snapshot
+// metadata alongside in metadata.json, so that git log and git blame work on
+// individual settings.
+type GitHistory struct {
+	dir     string
+	verbose bool
+}
+
+// OpenGitHistory opens the git repository at dir, initialising it if needed.
+func OpenGitHistory(dir string, verbose bool) (*GitHistory, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, NewExitError(ExitConfigError, "error: git is required for --git-repo but was not found in PATH", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, NewExitError(ExitOutputError, fmt.Sprintf("error: unable to create git repository directory %s", dir), err)
+	}
+
+	g := &GitHistory{dir: dir, verbose: verbose}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if _, err := g.git(nil, "init", "--quiet"); err != nil {
+			return nil, NewExitError(ExitOutputError, fmt.Sprintf("error: unable to initialise git repository in %s", dir), err)
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Initialised git repository in %s\n", dir)
+		}
+	}
+	return g, nil
+}
+
+// Commit writes the snapshot in the canonical layout and commits it. If the
+// configuration is unchanged since the last commit, nothing is committed and
+// committed is false. The commit message summarises the drift from the
+// previous commit.
+func (g *GitHistory) Commit(snapshot map[string]interface{}) (committed bool, commitID string, err error) {
+	var previous map[string]interface{}
+	if g.hasHead() {
+		previous, _, err = g.Load("HEAD", "")
+		if err != nil {
+			return false, "", err
+		}
+	}
+
+	if err := g.writeSections(snapshot); err != nil {
+		return false, "", err
+	}
+	if _, err := g.git(nil, "add", "--all", "--", gitSectionsDir); err != nil {
+		return false, "", NewExitError(ExitOutputError, "error: unable to stage snapshot in git repository", err)
+	}
+	if previous != nil {
+		if _, err := g.git(nil, "diff", "--cached", "--quiet", "--", gitSectionsDir); err == nil {
+			if g.verbose {
+				fmt.Fprintln(os.Stderr, "Configuration unchanged since last commit; nothing to commit.")
+			}
+			return false, "", nil
+		}
+	}
+
+	metaData, err := json.MarshalIndent(snapshot["_metadata"], "", "  ")
+	if err != nil {
+		return false, "", NewExitError(ExitOutputError, "error: failed to marshal snapshot metadata", err)
+	}
+	if err := os.WriteFile(filepath.Join(g.dir, gitMetadataFile), append(metaData, '\n'), 0644); err != nil {
+		return false, "", NewExitError(ExitOutputError, "error: unable to write snapshot metadata to git repository", err)
+	}
+	if _, err := g.git(nil, "add", "--", gitMetadataFile); err != nil {
+		return false, "", NewExitError(ExitOutputError, "error: unable to stage snapshot in git repository", err)
+	}
+
+	var result *DiffResult
+	if previous != nil {
+		result = CompareConfigs(previous, snapshot, nil)
+	}
+	message := GitCommitMessage(result, snapshot)
+
+	// Fill in whichever part of the committer identity git has no value for.
+	var args []string
+	for _, id := range [][2]string{{"user.name", gitDefaultAuthor}, {"user.email", gitDefaultEmail}} {
+		if out, _ := g.git(nil, "config", id[0]); strings.TrimSpace(out) == "" {
+			args = append(args, "-c", id[0]+"="+id[1])
+		}
+	}
+	args = append(args, "commit", "--quiet", "--file", "-")
+	if _, err := g.git(strings.NewReader(message), args...); err != nil {
+		return false, "", NewExitError(ExitOutputError, "error: unable to commit snapshot to git repository", err)
+	}
+
+	out, err := g.git(nil, "rev-parse", "HEAD")
+	if err != nil {
+		return true, "", nil
+	}
+	return true, strings.TrimSpace(out), nil
+}
+
+// Load reads a snapshot from a git revision. When path names a file, it is
+// parsed as a snapshot file; when it is empty or names a directory, the
+// snapshot is reassembled from the canonical section layout beneath it.
+func (g *GitHistory) Load(rev, filePath string) (map[string]interface{}, *SnapshotMetadata, error) {
+	ref := rev + ":" + filePath
+	objType, err := g.git(nil, "cat-file", "-t", ref)
+	if err != nil {
+		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s was not found in git repository %s", ref, g.dir), err)
+	}
+
+	if strings.TrimSpace(objType) == "blob" {
+		data, err := g.git(nil, "cat-file", "blob", ref)
+		if err != nil {
+			return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read %s from git repository", ref), err)
+		}
+		return ParseSnapshot([]byte(data), ref)
+	}
+
+	prefix := strings.TrimSuffix(filePath, "/")
+	sectionsPrefix := path.Join(prefix, gitSectionsDir)
+	list, err := g.git(nil, "ls-tree", "--name-only", rev+":"+sectionsPrefix)
+	if err != nil {
+		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s does not contain a snapshot in the mm-config-diff layout", ref), err)
+	}
+
+	config := make(map[string]interface{})
+	for _, name := range strings.Fields(list) {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := g.git(nil, "cat-file", "blob", rev+":"+path.Join(sectionsPrefix, name))
+		if err != nil {
+			return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read section %s from git repository", name), err)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: section file %s at %s is not valid JSON", name, rev), err)
+		}
+		config[strings.TrimSuffix(name, ".json")] = value
+	}
+
+	metaData, err := g.git(nil, "cat-file", "blob", rev+":"+path.Join(prefix, gitMetadataFile))
+	if err != nil {
+		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s is missing %s. Is this an mm-config-diff git repository?", ref, gitMetadataFile), err)
+	}
+	var metaMap map[string]interface{}
+	if err := json.Unmarshal([]byte(metaData), &metaMap); err != nil {
+		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s at %s is not valid JSON", gitMetadataFile, rev), err)
+	}
+	config["_metadata"] = metaMap
+
+	metadata, err := snapshotMetadata(config, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, metadata, nil
+}
+
+// writeSections replaces the section files in the working tree.
+func (g *GitHistory) writeSections(snapshot map[string]interface{}) error {
+	sectionsDir := filepath.Join(g.dir, gitSectionsDir)
+	if err := os.RemoveAll(sectionsDir); err != nil {
+		return NewExitError(ExitOutputError, "error: unable to clear section files in git repository", err)
+	}
+	if err := os.MkdirAll(sectionsDir, 0755); err != nil {
+		return NewExitError(ExitOutputError, "error: unable to create section directory in git repository", err)
+	}
+
+	for name, value := range StripMetadata(snapshot) {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return NewExitError(ExitOutputError, fmt.Sprintf("error: failed to marshal section %s", name), err)
+		}
+		if err := os.WriteFile(filepath.Join(sectionsDir, name+".json"), append(data, '\n'), 0644); err != nil {
+			return NewExitError(ExitOutputError, fmt.Sprintf("error: unable to write section %s to git repository", name), err)
+		}
+	}
+	return nil
+}
+
+// ResolvesRevision reports whether rev names a commit in the repository.
+func (g *GitHistory) ResolvesRevision(rev string) bool {
+	_, err := g.git(nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	return err == nil
+}
+
+func (g *GitHistory) hasHead() bool {
+	_, err := g.git(nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// git runs a git command in the repository and returns its stdout.
+func (g *GitHistory) git(stdin *strings.Reader, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return stdout.String(), fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// GitCommitMessage builds a commit message from the drift since the previous
+// commit. A nil result denotes the first commit in the repository.
+func GitCommitMessage(result *DiffResult, snapshot map[string]interface{}) string {
+	metaMap, _ := snapshot["_metadata"].(map[string]interface{})
+	serverURL := stringFromMap(metaMap, "server_url")
+	capturedAt := stringFromMap(metaMap, "captured_at")
+
+	var sb strings.Builder
+	if result == nil {
+		sb.WriteString("Initial configuration snapshot")
+	} else {
+		sb.WriteString(fmt.Sprintf("Configuration drift: %d changed, %d added, %d removed",
+			len(result.Changed), len(result.Added), len(result.Removed)))
+	}
+	sb.WriteString("\n\n")
+	if serverURL != "" {
+		sb.WriteString(fmt.Sprintf("Server   : %s\n", serverURL))
+	}
+	if capturedAt != "" {
+		sb.WriteString(fmt.Sprintf("Captured : %s\n", capturedAt))
+	}
+
+	if result != nil {
+		lines := make([]string, 0, len(result.Changed)+len(result.Added)+len(result.Removed))
+		for _, c := range result.Changed {
+			lines = append(lines, fmt.Sprintf("  ~ %s: %s -> %s", c.Field, FormatValue(c.Before), FormatValue(c.After)))
+		}
+		for _, a := range result.Added {
+			lines = append(lines, fmt.Sprintf("  + %s: %s", a.Field, FormatValue(a.Value)))
+		}
+		for _, r := range result.Removed {
+			lines = append(lines, fmt.Sprintf("  - %s", r.Field))
+		}
+		if len(lines) > 0 {
+			sb.WriteString("\n")
+			sb.WriteString(strings.Join(lines, "\n"))
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestGitHistory(t *testing.T) *GitHistory {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	history, err := OpenGitHistory(filepath.Join(t.TempDir(), "history"), false)
+	if err != nil {
+		t.Fatalf("OpenGitHistory failed: %v", err)
+	}
+	return history
+}
+
+func TestGitHistory_CommitOnlyOnChange(t *testing.T) {
+	history := newTestGitHistory(t)
+
+	committed, commitID, err := history.Commit(testSnapshot("2025-10-01T09:00:00Z", 10))
+	if err != nil {
+		t.Fatalf("first Commit failed: %v", err)
+	}
+	if !committed || commitID == "" {
+		t.Fatalf("first snapshot should be committed, got committed=%v id=%q", committed, commitID)
+	}
+
+	// Same config, new capture time: nothing to commit.
+	committed, _, err = history.Commit(testSnapshot("2025-10-02T09:00:00Z", 10))
+	if err != nil {
+		t.Fatalf("second Commit failed: %v", err)
+	}
+	if committed {
+		t.Error("unchanged config should not be committed")
+	}
+
+	committed, _, err = history.Commit(testSnapshot("2025-10-03T09:00:00Z", 5))
+	if err != nil {
+		t.Fatalf("third Commit failed: %v", err)
+	}
+	if !committed {
+		t.Fatal("changed config should be committed")
+	}
+
+	log, err := history.git(nil, "log", "--format=%s")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	subjects := strings.Split(strings.TrimSpace(log), "\n")
+	if len(subjects) != 2 {
+		t.Fatalf("expected 2 commits, got %d: %q", len(subjects), subjects)
+	}
+	if subjects[0] != "Configuration drift: 1 changed, 0 added, 0 removed" {
+		t.Errorf("unexpected subject %q", subjects[0])
+	}
+
+	if _, err := os.Stat(filepath.Join(history.dir, gitSectionsDir, "ServiceSettings.json")); err != nil {
+		t.Errorf("section file missing: %v", err)
+	}
+}
+
+func TestGitHistory_Load(t *testing.T) {
+	history := newTestGitHistory(t)
+	history.Commit(testSnapshot("2025-10-01T09:00:00Z", 10))
+	history.Commit(testSnapshot("2025-10-02T09:00:00Z", 5))
+
+	config, meta, err := history.Load("HEAD~1", "")
+	if err != nil {
+		t.Fatalf("Load(HEAD~1) failed: %v", err)
+	}
+	if meta.CapturedAt != "2025-10-01T09:00:00Z" {
+		t.Errorf("CapturedAt = %q", meta.CapturedAt)
+	}
+	svc := config["ServiceSettings"].(map[string]interface{})
+	if svc["MaximumLoginAttempts"] != float64(10) {
+		t.Errorf("MaximumLoginAttempts = %v", svc["MaximumLoginAttempts"])
+	}
+
+	if _, _, err := history.Load("HEAD~5", ""); err == nil {
+		t.Error("expected error for unknown revision")
+	}
+}
+
+func TestGitHistory_LoadBlob(t *testing.T) {
+	history := newTestGitHistory(t)
+
+	data, err := os.ReadFile("testdata/valid-snapshot.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(history.dir, "baseline.json"), data, 0644)
+	history.git(nil, "add", "baseline.json")
+	if _, err := history.git(nil, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "baseline"); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	config, _, src, err := LoadSnapshotRef(context.Background(), "HEAD:baseline.json", SnapshotSources{GitRepo: history.dir})
+	if err != nil {
+		t.Fatalf("LoadSnapshotRef failed: %v", err)
+	}
+	if src.Source != "git" || src.File != "HEAD:baseline.json" {
+		t.Errorf("source = %+v", src)
+	}
+	if _, ok := config["ServiceSettings"]; !ok {
+		t.Error("ServiceSettings missing from loaded snapshot")
+	}
+}
+
+func TestGitCommitMessage(t *testing.T) {
+	snapshot := testSnapshot("2025-10-01T09:00:00Z", 5)
+
+	initial := GitCommitMessage(nil, snapshot)
+	if !strings.HasPrefix(initial, "Initial configuration snapshot\n\n") {
+		t.Errorf("unexpected initial message %q", initial)
+	}
+
+	result := &DiffResult{
+		Changed: []ChangedField{{Field: "ServiceSettings.MaximumLoginAttempts", Before: float64(10), After: float64(5)}},
+		Added:   []AddedField{{Field: "ServiceSettings.NewSetting", Value: true}},
+		Removed: []RemovedField{{Field: "ServiceSettings.OldSetting", Value: "x"}},
+	}
+	msg := GitCommitMessage(result, snapshot)
+	for _, want := range []string{
+		"Configuration drift: 1 changed, 1 added, 1 removed",
+		"Server   : https://mm.example.com",
+		"Captured : 2025-10-01T09:00:00Z",
+		"~ ServiceSettings.MaximumLoginAttempts: 10 -> 5",
+		"+ ServiceSettings.NewSetting: true",
+		"- ServiceSettings.OldSetting",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestGitHistory_CommitFillsMissingIdentity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, name := range []string{"GIT_CONFIG_GLOBAL", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL", "EMAIL"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	history := newTestGitHistory(t)
+	// A name but no email, and no guessing of an email from the host name.
+	history.git(nil, "config", "user.name", "Ops Team")
+	history.git(nil, "config", "user.useConfigOnly", "true")
+
+	if _, _, err := history.Commit(testSnapshot("2025-10-01T09:00:00Z", 10)); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	author, _ := history.git(nil, "log", "-1", "--format=%an <%ae>")
+	if strings.TrimSpace(author) != "Ops Team <"+gitDefaultEmail+">" {
+		t.Errorf("author = %q", author)
+	}
+}
+
+func TestLoadSnapshotRef_StoreTimestampWithGitRepo(t *testing.T) {
+	history := newTestGitHistory(t)
+	history.Commit(testSnapshot("2025-10-01T09:00:00Z", 10))
+
+	storeDir := t.TempDir()
+	store, _ := CreateStore(storeDir)
+	store.Add(testSnapshot("2025-10-01T09:00:00Z", 7))
+	sources := SnapshotSources{StoreDir: storeDir, GitRepo: history.dir}
+
+	// A timestamp reference contains a colon but is not a git revision.
+	_, meta, src, err := LoadSnapshotRef(context.Background(), "2025-10-01T12:00:00Z", sources)
+	if err != nil {
+		t.Fatalf("LoadSnapshotRef failed: %v", err)
+	}
+	if src.Source != "store" || meta.CapturedAt != "2025-10-01T09:00:00Z" {
+		t.Errorf("source = %+v", src)
+	}
+
+	if _, _, src, err := LoadSnapshotRef(context.Background(), "HEAD:", sources); err != nil || src.Source != "git" {
+		t.Errorf("HEAD: source = %+v, error = %v", src, err)
+	}
+}
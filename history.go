@@ -0,0 +1,431 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// historySchema creates the history database tables.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	id           INTEGER PRIMARY KEY,
+	server_url   TEXT NOT NULL,
+	captured_at  TEXT NOT NULL,
+	tool_version TEXT NOT NULL DEFAULT '',
+	content_hash TEXT NOT NULL,
+	config       TEXT NOT NULL,
+	UNIQUE (server_url, captured_at)
+);
+CREATE TABLE IF NOT EXISTS changes (
+	id             INTEGER PRIMARY KEY,
+	server_url     TEXT NOT NULL,
+	field          TEXT NOT NULL,
+	change_type    TEXT NOT NULL,
+	before_value   TEXT,
+	after_value    TEXT,
+	severity       TEXT NOT NULL,
+	interval_start TEXT NOT NULL DEFAULT '',
+	interval_end   TEXT NOT NULL,
+	origin         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS changes_field ON changes (field);
+CREATE INDEX IF NOT EXISTS changes_interval_end ON changes (interval_end);
+`
+
+// Origins of recorded changes.
+const (
+	OriginSnapshot = "snapshot" // derived from consecutive ingested snapshots
+	OriginDiff     = "diff"     // recorded from a diff run
+)
+
+// HistoryDB is an embedded SQLite database of snapshots and the changes
+// between them.
+type HistoryDB struct {
+	db *sql.DB
+}
+
+// HistoryChange is one recorded field change.
+type HistoryChange struct {
+	ServerURL     string      `json:"server_url"`
+	Field         string      `json:"field"`
+	ChangeType    string      `json:"change_type"` // "changed", "added" or "removed"
+	Before        interface{} `json:"before,omitempty"`
+	After         interface{} `json:"after,omitempty"`
+	Severity      string      `json:"severity"`
+	IntervalStart string      `json:"interval_start,omitempty"`
+	IntervalEnd   string      `json:"interval_end"`
+	Origin        string      `json:"origin"`
+}
+
+// HistoryQuery filters changes. Empty fields match everything.
+type HistoryQuery struct {
+	Path       string // glob pattern, or a path prefix if it has no wildcards
+	Since      time.Time
+	Until      time.Time
+	ServerURL  string
+	ChangeType string
+	Severity   string
+}
+
+// OpenHistoryDB opens or creates the history database at path.
+func OpenHistoryDB(path string) (*HistoryDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to open history database %s", path), err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to initialise history database %s", path), err)
+	}
+	return &HistoryDB{db: db}, nil
+}
+
+// Close closes the database.
+func (h *HistoryDB) Close() error {
+	return h.db.Close()
+}
+
+// IngestSnapshot records a snapshot and the changes since the previous
+// snapshot of the same server. A snapshot older than one already ingested
+// splits the interval between its neighbours, whose changes are recomputed.
+// It returns the number of changes recorded, and is a no-op if the snapshot
+// was already ingested.
+func (h *HistoryDB) IngestSnapshot(snapshot map[string]interface{}) (int, error) {
+	metaMap, _ := snapshot["_metadata"].(map[string]interface{})
+	serverURL := stringFromMap(metaMap, "server_url")
+	capturedAt := normaliseTimestamp(stringFromMap(metaMap, "captured_at"))
+	if capturedAt == "" {
+		return 0, NewExitError(ExitConfigError, "error: snapshot has no captured_at timestamp and cannot be recorded", nil)
+	}
+
+	hash, err := ContentHash(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	configJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, NewExitError(ExitOutputError, "error: failed to marshal snapshot for the history database", err)
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, historyError(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT OR IGNORE INTO snapshots (server_url, captured_at, tool_version, content_hash, config)
+		VALUES (?, ?, ?, ?, ?)`, serverURL, capturedAt, stringFromMap(metaMap, "tool_version"), hash, string(configJSON))
+	if err != nil {
+		return 0, historyError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, nil
+	}
+
+	current := &storedSnapshot{capturedAt: capturedAt, hash: hash, config: snapshot}
+	prev, err := adjacentSnapshot(tx, serverURL, capturedAt, false)
+	if err != nil {
+		return 0, err
+	}
+	next, err := adjacentSnapshot(tx, serverURL, capturedAt, true)
+	if err != nil {
+		return 0, err
+	}
+	if prev != nil && next != nil {
+		if _, err := tx.Exec(`DELETE FROM changes WHERE server_url = ? AND origin = ? AND interval_start = ? AND interval_end = ?`,
+			serverURL, OriginSnapshot, prev.capturedAt, next.capturedAt); err != nil {
+			return 0, historyError(err)
+		}
+	}
+
+	count := 0
+	for _, pair := range [][2]*storedSnapshot{{prev, current}, {current, next}} {
+		if pair[0] == nil || pair[1] == nil || pair[0].hash == pair[1].hash {
+			continue
+		}
+		result := CompareConfigs(pair[0].config, pair[1].config, nil)
+		n, err := insertChanges(tx, result, serverURL, pair[0].capturedAt, pair[1].capturedAt, OriginSnapshot)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+
+	return count, historyError(tx.Commit())
+}
+
+// storedSnapshot is a snapshot read back from the history database.
+type storedSnapshot struct {
+	capturedAt string
+	hash       string
+	config     map[string]interface{}
+}
+
+// adjacentSnapshot returns the snapshot of a server captured just before,
+// or with after set just after, capturedAt; nil if there is none.
+func adjacentSnapshot(tx *sql.Tx, serverURL, capturedAt string, after bool) (*storedSnapshot, error) {
+	query := `SELECT captured_at, content_hash, config FROM snapshots
+		WHERE server_url = ? AND captured_at < ? ORDER BY captured_at DESC LIMIT 1`
+	if after {
+		query = `SELECT captured_at, content_hash, config FROM snapshots
+		WHERE server_url = ? AND captured_at > ? ORDER BY captured_at ASC LIMIT 1`
+	}
+
+	var snap storedSnapshot
+	var configJSON string
+	err := tx.QueryRow(query, serverURL, capturedAt).Scan(&snap.capturedAt, &snap.hash, &configJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, historyError(err)
+	}
+	if err := json.Unmarshal([]byte(configJSON), &snap.config); err != nil {
+		return nil, NewExitError(ExitConfigError, "error: history database holds an invalid snapshot", err)
+	}
+	return &snap, nil
+}
+
+// RecordDiff records the changes in a diff result. The interval runs from
+// the baseline's capture time to comparedAt. A change already recorded by
+// the last diff of the same field, as when a schedule keeps diffing
+// against one baseline, is not recorded again; its interval is extended
+// to comparedAt instead. It returns the number of new changes.
+func (h *HistoryDB) RecordDiff(result *DiffResult, serverURL string, comparedAt time.Time) (int, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, historyError(err)
+	}
+	defer tx.Rollback()
+
+	count, err := insertChanges(tx, result, serverURL, normaliseTimestamp(result.Baseline.CapturedAt),
+		comparedAt.UTC().Format(time.RFC3339), OriginDiff)
+	if err != nil {
+		return 0, err
+	}
+	return count, historyError(tx.Commit())
+}
+
+func insertChanges(tx *sql.Tx, result *DiffResult, serverURL, start, end, origin string) (int, error) {
+	stmt, err := tx.Prepare(`INSERT INTO changes
+		(server_url, field, change_type, before_value, after_value, severity, interval_start, interval_end, origin)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, historyError(err)
+	}
+	defer stmt.Close()
+
+	count := 0
+	insert := func(field, changeType string, before, after interface{}, hasBefore, hasAfter bool) error {
+		beforeValue, afterValue := jsonValue(before, hasBefore), jsonValue(after, hasAfter)
+		if origin == OriginDiff {
+			extended, err := extendLastDiff(tx, serverURL, field, changeType, beforeValue, afterValue, end)
+			if err != nil || extended {
+				return err
+			}
+		}
+		if _, err := stmt.Exec(serverURL, field, changeType, beforeValue, afterValue,
+			FieldSeverity(field), start, end, origin); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	for _, c := range result.Changed {
+		if err := insert(c.Field, "changed", c.Before, c.After, true, true); err != nil {
+			return 0, historyError(err)
+		}
+	}
+	for _, a := range result.Added {
+		if err := insert(a.Field, "added", nil, a.Value, false, true); err != nil {
+			return 0, historyError(err)
+		}
+	}
+	for _, r := range result.Removed {
+		if err := insert(r.Field, "removed", r.Value, nil, true, false); err != nil {
+			return 0, historyError(err)
+		}
+	}
+	return count, nil
+}
+
+// extendLastDiff extends the interval of the last change recorded by a
+// diff for a field to end, if it is the same change. It reports whether
+// it did.
+func extendLastDiff(tx *sql.Tx, serverURL, field, changeType string, before, after interface{}, end string) (bool, error) {
+	var (
+		id                    int64
+		lastType, lastEnd     string
+		lastBefore, lastAfter sql.NullString
+	)
+	err := tx.QueryRow(`SELECT id, change_type, before_value, after_value, interval_end FROM changes
+		WHERE server_url = ? AND field = ? AND origin = ? ORDER BY interval_end DESC, id DESC LIMIT 1`,
+		serverURL, field, OriginDiff).Scan(&id, &lastType, &lastBefore, &lastAfter, &lastEnd)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if lastType != changeType || !sameStoredValue(lastBefore, before) || !sameStoredValue(lastAfter, after) {
+		return false, nil
+	}
+	if end > lastEnd {
+		if _, err := tx.Exec(`UPDATE changes SET interval_end = ? WHERE id = ?`, end, id); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// sameStoredValue reports whether a stored value equals one from jsonValue.
+func sameStoredValue(stored sql.NullString, v interface{}) bool {
+	s, ok := v.(string)
+	return stored.Valid == ok && stored.String == s
+}
+
+// Query returns the changes matching q, oldest first.
+func (h *HistoryDB) Query(q HistoryQuery) ([]HistoryChange, error) {
+	switch q.ChangeType {
+	case "", "changed", "added", "removed":
+	default:
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported change type %q. Use 'changed', 'added' or 'removed'.", q.ChangeType), nil)
+	}
+	switch q.Severity {
+	case "", "high", "medium", "low":
+	default:
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported severity %q. Use 'high', 'medium' or 'low'.", q.Severity), nil)
+	}
+
+	var where []string
+	var args []interface{}
+
+	if q.Path != "" {
+		if strings.ContainsAny(q.Path, "*?[") {
+			where = append(where, "field GLOB ?")
+			args = append(args, q.Path)
+		} else {
+			where = append(where, "(field = ? OR field GLOB ?)")
+			args = append(args, q.Path, globEscape(q.Path)+".*")
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "interval_end >= ?")
+		args = append(args, q.Since.UTC().Format(time.RFC3339))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "interval_end <= ?")
+		args = append(args, q.Until.UTC().Format(time.RFC3339))
+	}
+	if q.ServerURL != "" {
+		where = append(where, "server_url = ?")
+		args = append(args, strings.TrimRight(q.ServerURL, "/"))
+	}
+	if q.ChangeType != "" {
+		where = append(where, "change_type = ?")
+		args = append(args, q.ChangeType)
+	}
+	if q.Severity != "" {
+		where = append(where, "severity = ?")
+		args = append(args, q.Severity)
+	}
+
+	query := `SELECT server_url, field, change_type, before_value, after_value, severity, interval_start, interval_end, origin
+		FROM changes`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY interval_end, field, id"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, historyError(err)
+	}
+	defer rows.Close()
+
+	changes := []HistoryChange{}
+	for rows.Next() {
+		var c HistoryChange
+		var before, after sql.NullString
+		if err := rows.Scan(&c.ServerURL, &c.Field, &c.ChangeType, &before, &after, &c.Severity,
+			&c.IntervalStart, &c.IntervalEnd, &c.Origin); err != nil {
+			return nil, historyError(err)
+		}
+		if before.Valid {
+			json.Unmarshal([]byte(before.String), &c.Before)
+		}
+		if after.Valid {
+			json.Unmarshal([]byte(after.String), &c.After)
+		}
+		changes = append(changes, c)
+	}
+	return changes, historyError(rows.Err())
+}
+
+// jsonValue encodes a value for storage, or returns NULL if absent.
+func jsonValue(v interface{}, present bool) interface{} {
+	if !present {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// globEscape escapes SQLite GLOB metacharacters in a literal string.
+func globEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[':
+			sb.WriteString("[" + string(r) + "]")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// normaliseTimestamp converts an RFC 3339 timestamp to UTC so that stored
+// timestamps compare correctly as text. Other values are returned unchanged.
+func normaliseTimestamp(ts string) string {
+	if t, err := time.Parse(time.RFC3339, ts); err == nil {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return ts
+}
+
+func historyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return NewExitError(ExitOutputError, "error: history database operation failed", err)
+}
+
+// ParseHistoryTime parses a --since/--until value: an RFC 3339 timestamp or
+// a date. A bare date means the start of that day, or its end if endOfDay
+// is set.
+func ParseHistoryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, NewExitError(ExitConfigError, fmt.Sprintf("error: invalid time %q. Use a date (2025-10-01) or an RFC 3339 timestamp.", value), nil)
+	}
+	if endOfDay {
+		d = d.Add(24*time.Hour - time.Second)
+	}
+	return d, nil
+}
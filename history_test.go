@@ -0,0 +1,240 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestHistoryDB(t *testing.T) *HistoryDB {
+	t.Helper()
+	db, err := OpenHistoryDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("OpenHistoryDB failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func historySnapshot(capturedAt string, minLength float64, extra map[string]interface{}) map[string]interface{} {
+	snapshot := testSnapshot(capturedAt, 10)
+	snapshot["PasswordSettings"] = map[string]interface{}{"MinimumLength": minLength}
+	for k, v := range extra {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+func TestHistoryDB_IngestSnapshot(t *testing.T) {
+	db := openTestHistoryDB(t)
+
+	count, err := db.IngestSnapshot(historySnapshot("2025-10-01T09:00:00Z", 8, nil))
+	if err != nil {
+		t.Fatalf("IngestSnapshot failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("first snapshot should record no changes, got %d", count)
+	}
+
+	// Unchanged content records nothing.
+	count, _ = db.IngestSnapshot(historySnapshot("2025-10-02T09:00:00Z", 8, nil))
+	if count != 0 {
+		t.Errorf("unchanged snapshot recorded %d changes", count)
+	}
+
+	count, err = db.IngestSnapshot(historySnapshot("2025-10-03T09:00:00Z", 12, map[string]interface{}{
+		"DisplaySettings": map[string]interface{}{"ExperimentalTimezone": true},
+	}))
+	if err != nil {
+		t.Fatalf("IngestSnapshot failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 changes, got %d", count)
+	}
+
+	// Re-ingesting the same snapshot is a no-op.
+	count, _ = db.IngestSnapshot(historySnapshot("2025-10-03T09:00:00Z", 12, nil))
+	if count != 0 {
+		t.Errorf("re-ingest recorded %d changes", count)
+	}
+
+	changes, err := db.Query(HistoryQuery{Path: "PasswordSettings"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 PasswordSettings change, got %d", len(changes))
+	}
+	c := changes[0]
+	if c.Field != "PasswordSettings.MinimumLength" || c.ChangeType != "changed" {
+		t.Errorf("unexpected change %+v", c)
+	}
+	if c.Before != float64(8) || c.After != float64(12) {
+		t.Errorf("before/after = %v/%v", c.Before, c.After)
+	}
+	if c.Severity != SeverityHigh {
+		t.Errorf("severity = %q", c.Severity)
+	}
+	if c.IntervalStart != "2025-10-02T09:00:00Z" || c.IntervalEnd != "2025-10-03T09:00:00Z" {
+		t.Errorf("interval = %s .. %s", c.IntervalStart, c.IntervalEnd)
+	}
+	if c.Origin != OriginSnapshot || c.ServerURL != "https://mm.example.com" {
+		t.Errorf("origin/server = %s/%s", c.Origin, c.ServerURL)
+	}
+}
+
+func TestHistoryDB_IngestOutOfOrder(t *testing.T) {
+	db := openTestHistoryDB(t)
+	db.IngestSnapshot(historySnapshot("2025-10-01T09:00:00Z", 8, nil))
+	db.IngestSnapshot(historySnapshot("2025-10-03T09:00:00Z", 12, nil))
+
+	// The missing middle snapshot replaces the 8 -> 12 change with two.
+	count, err := db.IngestSnapshot(historySnapshot("2025-10-02T09:00:00Z", 10, nil))
+	if err != nil {
+		t.Fatalf("IngestSnapshot failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 changes, got %d", count)
+	}
+
+	changes, err := db.Query(HistoryQuery{Path: "PasswordSettings.MinimumLength"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %+v", changes)
+	}
+	for i, want := range []struct {
+		before, after float64
+		start, end    string
+	}{
+		{8, 10, "2025-10-01T09:00:00Z", "2025-10-02T09:00:00Z"},
+		{10, 12, "2025-10-02T09:00:00Z", "2025-10-03T09:00:00Z"},
+	} {
+		c := changes[i]
+		if c.Before != want.before || c.After != want.after || c.IntervalStart != want.start || c.IntervalEnd != want.end {
+			t.Errorf("change %d = %+v, want %+v", i, c, want)
+		}
+	}
+}
+
+func TestHistoryDB_QueryValidation(t *testing.T) {
+	db := openTestHistoryDB(t)
+	for _, q := range []HistoryQuery{{ChangeType: "modified"}, {Severity: "critical"}} {
+		_, err := db.Query(q)
+		if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+			t.Errorf("Query(%+v) error = %v, want ExitConfigError", q, err)
+		}
+	}
+}
+
+func TestHistoryDB_RecordDiffAndQuery(t *testing.T) {
+	db := openTestHistoryDB(t)
+
+	result := &DiffResult{
+		Baseline: DiffSource{CapturedAt: "2025-07-01T09:00:00Z"},
+		Changed: []ChangedField{
+			{Field: "ServiceSettings.SessionLengthWebInHours", Before: float64(720), After: float64(24)},
+		},
+		Added:   []AddedField{{Field: "ExperimentalSettings.NewFeature", Value: true}},
+		Removed: []RemovedField{{Field: "PasswordSettings.Symbol", Value: true}},
+	}
+	if _, err := db.RecordDiff(result, "https://a.example.com", time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("RecordDiff failed: %v", err)
+	}
+	if _, err := db.RecordDiff(result, "https://b.example.com", time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("RecordDiff failed: %v", err)
+	}
+
+	since, _ := ParseHistoryTime("2025-07-01", false)
+	until, _ := ParseHistoryTime("2025-09-30", true)
+
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  int
+	}{
+		{"everything", HistoryQuery{}, 6},
+		{"section prefix", HistoryQuery{Path: "PasswordSettings"}, 2},
+		{"glob", HistoryQuery{Path: "*Session*"}, 2},
+		{"prefix does not match sibling", HistoryQuery{Path: "PasswordSetting"}, 0},
+		{"time range", HistoryQuery{Since: since, Until: until}, 3},
+		{"server", HistoryQuery{ServerURL: "https://b.example.com/"}, 3},
+		{"change type", HistoryQuery{ChangeType: "removed"}, 2},
+		{"severity", HistoryQuery{Severity: SeverityLow}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := db.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(changes) != tt.want {
+				t.Errorf("got %d changes, want %d: %+v", len(changes), tt.want, changes)
+			}
+		})
+	}
+
+	removed, _ := db.Query(HistoryQuery{ChangeType: "removed", ServerURL: "https://a.example.com"})
+	if removed[0].Before != true || removed[0].After != nil {
+		t.Errorf("removed change before/after = %v/%v", removed[0].Before, removed[0].After)
+	}
+	if removed[0].Origin != OriginDiff || removed[0].IntervalStart != "2025-07-01T09:00:00Z" {
+		t.Errorf("unexpected removed change %+v", removed[0])
+	}
+}
+
+func TestHistoryDB_RecordDiffTwice(t *testing.T) {
+	db := openTestHistoryDB(t)
+
+	result := &DiffResult{
+		Baseline: DiffSource{CapturedAt: "2025-07-01T09:00:00Z"},
+		Changed:  []ChangedField{{Field: "ServiceSettings.SessionLengthWebInHours", Before: float64(720), After: float64(24)}},
+		Removed:  []RemovedField{{Field: "PasswordSettings.Symbol", Value: true}},
+	}
+	first := time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC)
+	if n, err := db.RecordDiff(result, "https://a.example.com", first); err != nil || n != 2 {
+		t.Fatalf("first RecordDiff = %d, %v", n, err)
+	}
+	// The next night's diff against the same baseline finds the same drift.
+	second := first.Add(24 * time.Hour)
+	if n, err := db.RecordDiff(result, "https://a.example.com", second); err != nil || n != 0 {
+		t.Fatalf("second RecordDiff = %d, %v; want no new changes", n, err)
+	}
+
+	changes, err := db.Query(HistoryQuery{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+	for _, c := range changes {
+		if c.IntervalEnd != "2025-08-16T00:00:00Z" {
+			t.Errorf("%s interval end = %s, want it extended to the second diff", c.Field, c.IntervalEnd)
+		}
+	}
+
+	// A further change to the same field is recorded.
+	result.Changed[0].After = float64(12)
+	if n, err := db.RecordDiff(result, "https://a.example.com", second.Add(24*time.Hour)); err != nil || n != 1 {
+		t.Errorf("third RecordDiff = %d, %v; want the new change only", n, err)
+	}
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	start, err := ParseHistoryTime("2025-10-01", false)
+	if err != nil || !start.Equal(time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("start of day = %v, %v", start, err)
+	}
+	end, _ := ParseHistoryTime("2025-10-01", true)
+	if !end.Equal(time.Date(2025, 10, 1, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("end of day = %v", end)
+	}
+	if ts, _ := ParseHistoryTime("", false); !ts.IsZero() {
+		t.Error("empty value should give the zero time")
+	}
+	if _, err := ParseHistoryTime("last tuesday", false); err == nil {
+		t.Error("expected error for unparseable time")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// htmlDiffMinLength is the length from which changed strings are shown as
+// a word-level diff rather than as two whole values.
+const htmlDiffMinLength = 40
+
+type htmlEntry struct {
+	DiffEntry
+	Name     string // field without its section
+	Severity string
+	Before   string
+	After    string
+	Spans    []DiffSpan // set for long strings and arrays
+	Array    bool       // spans are array items
+}
+
+type htmlSection struct {
+	Name    string
+	Entries []htmlEntry
+	Counts  map[string]int
+}
+
+type htmlReport struct {
+	Result     *DiffResult
+	Baseline   string
+	Compared   string
+	Sections   []htmlSection
+	NotVisible []NotVisibleField
+}
+
+// FormatDiffHTML produces a single self-contained HTML report for a diff
+// result, with no external assets. Sections can be filtered and collapsed,
+// fields searched, and long strings and arrays show a value diff.
+func FormatDiffHTML(result *DiffResult) (string, error) {
+	report := htmlReport{
+		Result:     result,
+		Baseline:   formatSource(result.Baseline),
+		Compared:   formatSource(result.Compared),
+		NotVisible: result.NotVisible,
+	}
+	for _, group := range GroupBySection(result.Entries()) {
+		section := htmlSection{Name: group.Section, Counts: map[string]int{}}
+		for _, e := range group.Entries {
+			section.Counts[e.ChangeType]++
+			entry := htmlEntry{
+				DiffEntry: e,
+				Name:      strings.TrimPrefix(e.Field, group.Section+"."),
+				Severity:  FieldSeverity(e.Field),
+			}
+			if e.ChangeType != "added" {
+				entry.Before = FormatValue(e.Before)
+			}
+			if e.ChangeType != "removed" {
+				entry.After = FormatValue(e.After)
+			}
+			if e.ChangeType == "changed" {
+				entry.Spans, entry.Array = ValueDiff(e.Before, e.After)
+			}
+			section.Entries = append(section.Entries, entry)
+		}
+		report.Sections = append(report.Sections, section)
+	}
+
+	var sb strings.Builder
+	if err := htmlReportTemplate.Execute(&sb, report); err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to render HTML report", err)
+	}
+	return sb.String(), nil
+}
+
+var wordPattern = regexp.MustCompile(`\w+|\s+|[^\w\s]`)
+
+// ValueDiff diffs two values for display: arrays item by item, and long
+// strings word by word. It returns nil for other values, or values too
+// large to diff. The bool reports whether the spans are array items.
+func ValueDiff(before, after interface{}) ([]DiffSpan, bool) {
+	if a, ok := before.([]interface{}); ok {
+		if b, ok := after.([]interface{}); ok {
+			return diffTokens(formatItems(a), formatItems(b)), true
+		}
+	}
+	a, okA := before.(string)
+	b, okB := after.(string)
+	if okA && okB && (len(a) >= htmlDiffMinLength || len(b) >= htmlDiffMinLength) {
+		return mergeSpans(diffTokens(wordPattern.FindAllString(a, -1), wordPattern.FindAllString(b, -1))), false
+	}
+	return nil, false
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"value": FormatValue}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Configuration drift report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { font-size: 1.6em; margin-bottom: 0.3em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.35em 0.6em; border-bottom: 1px solid #d0d7de; vertical-align: top; }
+th { background: #f6f8fa; }
+code, .value { font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; font-size: 0.9em; word-break: break-all; }
+.provenance td:first-child { font-weight: 600; width: 8em; }
+.summary { display: flex; gap: 1em; margin: 1em 0; }
+.summary div { padding: 0.5em 1em; border-radius: 6px; }
+.controls { display: flex; flex-wrap: wrap; gap: 1em; align-items: center; margin: 1em 0; padding: 0.6em; background: #f6f8fa; border-radius: 6px; }
+.controls input[type=search] { padding: 0.3em; min-width: 20em; }
+details.section { margin: 0.8em 0; border: 1px solid #d0d7de; border-radius: 6px; }
+details.section > summary { cursor: pointer; padding: 0.5em 0.8em; font-weight: 600; background: #f6f8fa; }
+details.section > summary .counts { font-weight: normal; color: #656d76; margin-left: 1em; }
+.changed { background: #fff8c5; } .added { background: #dafbe1; } .removed { background: #ffebe9; } .not-visible { background: #eaeef2; }
+.badge { display: inline-block; padding: 0 0.5em; border-radius: 1em; font-size: 0.85em; }
+.sev-high { color: #cf222e; font-weight: 600; } .sev-medium { color: #9a6700; } .sev-low { color: #656d76; }
+del { background: #ffcecb; text-decoration: line-through; } ins { background: #aceebb; text-decoration: none; }
+.items del, .items ins, .items span { display: block; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>Configuration drift report</h1>
+<table class="provenance">
+<tr><td>Baseline</td><td>{{.Baseline}}</td></tr>
+<tr><td>Compared</td><td>{{.Compared}}</td></tr>
+</table>
+{{if not .Result.DriftDetected}}
+<p>No configuration drift detected.</p>
+{{else}}
+<div class="summary">
+<div class="changed">Changed: <strong>{{len .Result.Changed}}</strong></div>
+<div class="added">Added: <strong>{{len .Result.Added}}</strong></div>
+<div class="removed">Removed: <strong>{{len .Result.Removed}}</strong></div>
+{{if .NotVisible}}<div class="not-visible">Not visible: <strong>{{len .NotVisible}}</strong></div>{{end}}
+</div>
+<div class="controls">
+<input type="search" id="search" placeholder="Search settings and values" aria-label="Search">
+<label><input type="checkbox" class="type-filter" value="changed" checked> Changed</label>
+<label><input type="checkbox" class="type-filter" value="added" checked> Added</label>
+<label><input type="checkbox" class="type-filter" value="removed" checked> Removed</label>
+<select id="section-filter" aria-label="Section">
+<option value="">All sections</option>
+{{range .Sections}}<option value="{{.Name}}">{{.Name}}</option>
+{{end}}</select>
+<button type="button" id="expand">Expand all</button>
+<button type="button" id="collapse">Collapse all</button>
+</div>
+{{range .Sections}}
+<details class="section" open data-section="{{.Name}}">
+<summary>{{.Name}}<span class="counts">{{with index .Counts "changed"}}{{.}} changed {{end}}{{with index .Counts "added"}}{{.}} added {{end}}{{with index .Counts "removed"}}{{.}} removed{{end}}</span></summary>
+<table>
+<tr><th>Setting</th><th>Change</th><th>Severity</th><th>Before</th><th>After</th></tr>
+{{range .Entries}}<tr class="entry {{.ChangeType}}" data-type="{{.ChangeType}}" data-search="{{.Field}} {{.Before}} {{.After}}">
+<td><code>{{.Name}}</code></td>
+<td><span class="badge {{.ChangeType}}">{{.ChangeType}}</span></td>
+<td class="sev-{{.Severity}}">{{.Severity}}</td>
+{{if .Spans}}<td colspan="2" class="value{{if .Array}} items{{end}}">{{range .Spans}}{{if eq .Op "del"}}<del>{{.Text}}</del>{{else if eq .Op "ins"}}<ins>{{.Text}}</ins>{{else}}<span>{{.Text}}</span>{{end}}{{end}}</td>
+{{else}}<td class="value">{{.Before}}</td><td class="value">{{.After}}</td>
+{{end}}</tr>
+{{end}}</table>
+</details>
+{{end}}
+{{end}}
+{{if .NotVisible}}
+<details class="section" open>
+<summary>Not visible<span class="counts">settings one capture could not read, not compared</span></summary>
+<table>
+<tr><th>Setting</th><th>Not readable in</th><th>Value</th></tr>
+{{range .NotVisible}}<tr class="not-visible"><td><code>{{.Field}}</code></td><td>{{.HiddenIn}}</td><td class="value">{{value .Value}}</td></tr>
+{{end}}</table>
+</details>
+{{end}}
+<script>
+(function () {
+  var search = document.getElementById("search");
+  if (!search) { return; }
+  var sectionFilter = document.getElementById("section-filter");
+  var typeFilters = document.querySelectorAll(".type-filter");
+  var sections = document.querySelectorAll("details.section[data-section]");
+
+  function apply() {
+    var query = search.value.toLowerCase();
+    var types = {};
+    typeFilters.forEach(function (box) { types[box.value] = box.checked; });
+    sections.forEach(function (section) {
+      var visible = 0;
+      section.querySelectorAll("tr.entry").forEach(function (row) {
+        var show = types[row.dataset.type] && row.dataset.search.toLowerCase().indexOf(query) >= 0;
+        row.classList.toggle("hidden", !show);
+        if (show) { visible++; }
+      });
+      var wanted = !sectionFilter.value || sectionFilter.value === section.dataset.section;
+      section.classList.toggle("hidden", !wanted || visible === 0);
+    });
+  }
+
+  search.addEventListener("input", apply);
+  sectionFilter.addEventListener("change", apply);
+  typeFilters.forEach(function (box) { box.addEventListener("change", apply); });
+  document.getElementById("expand").addEventListener("click", function () {
+    sections.forEach(function (s) { s.open = true; });
+  });
+  document.getElementById("collapse").addEventListener("click", function () {
+    sections.forEach(function (s) { s.open = false; });
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatDiffHTML(t *testing.T) {
+	result := sampleDiffResult()
+	result.Changed = append(result.Changed,
+		ChangedField{
+			Field:  "ServiceSettings.SiteURL",
+			Before: "https://mm.example.com/teams/engineering/<script>",
+			After:  "https://chat.example.com/teams/engineering/<script>",
+		},
+		ChangedField{
+			Field:  "TeamSettings.ExperimentalDefaultChannels",
+			Before: []interface{}{"town-square"},
+			After:  []interface{}{"town-square", "off-topic"},
+		},
+	)
+	out, err := FormatDiffHTML(result)
+	if err != nil {
+		t.Fatalf("FormatDiffHTML failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"baseline.json (captured 2025-10-01T09:00:00Z)",
+		"live instance at https://mm.example.com",
+		`<details class="section" open data-section="ServiceSettings">`,
+		`<tr class="entry changed" data-type="changed"`,
+		`<td class="sev-high">high</td>`,
+		`<input type="search" id="search"`,
+		// Array items are diffed one per line.
+		`<td colspan="2" class="value items">`,
+		// Long strings are diffed word by word.
+		"<del>mm</del><ins>chat</ins>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q", want)
+		}
+	}
+	if strings.Contains(out, "<script>\"") || strings.Contains(out, "/<script>") {
+		t.Error("values must be HTML-escaped")
+	}
+	// Self-contained: no external assets.
+	for _, external := range []string{"<link", "src=", "http-equiv"} {
+		if strings.Contains(out, external) {
+			t.Errorf("output references external assets (%q)", external)
+		}
+	}
+}
+
+func TestFormatDiffHTML_NoDrift(t *testing.T) {
+	out, err := FormatDiffHTML(&DiffResult{})
+	if err != nil {
+		t.Fatalf("FormatDiffHTML failed: %v", err)
+	}
+	if !strings.Contains(out, "No configuration drift detected.") || strings.Contains(out, `id="search"`) {
+		t.Error("a report without drift should have no filter controls")
+	}
+}
+
+func TestValueDiff(t *testing.T) {
+	spans, array := ValueDiff([]interface{}{"a", "b", "c"}, []interface{}{"a", "c", "d"})
+	want := []DiffSpan{{"same", `"a"`}, {"del", `"b"`}, {"same", `"c"`}, {"ins", `"d"`}}
+	if !array || !reflect.DeepEqual(spans, want) {
+		t.Errorf("array diff = %v", spans)
+	}
+
+	if spans, _ := ValueDiff("short", "other"); spans != nil {
+		t.Errorf("short strings should not be diffed: %v", spans)
+	}
+	if spans, _ := ValueDiff(float64(1), float64(2)); spans != nil {
+		t.Errorf("numbers should not be diffed: %v", spans)
+	}
+
+	spans, _ = ValueDiff("the quick brown fox jumps over the lazy dog", "the quick red fox jumps over the lazy dog")
+	want = []DiffSpan{{"same", "the quick "}, {"del", "brown"}, {"ins", "red"}, {"same", " fox jumps over the lazy dog"}}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("string diff = %v", spans)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+
+	field string
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// FormatDiffJUnit produces a JUnit XML report for a diff result, for CI
+// systems that display test results. Each config section is a test suite,
+// and each field a test case that fails if it drifted. Fields left out by
+// --ignore-fields, or that one capture could not read, are skipped. With
+// driftOnly, unchanged fields are left out.
+func FormatDiffJUnit(result *DiffResult, driftOnly bool) (string, error) {
+	cases := make(map[string][]junitTestCase)
+	add := func(field string, tc junitTestCase) {
+		section := configSection(field)
+		tc.Name = strings.TrimPrefix(strings.TrimPrefix(field, section), ".")
+		if tc.Name == "" {
+			tc.Name = field
+		}
+		tc.ClassName = section
+		tc.field = field
+		cases[section] = append(cases[section], tc)
+	}
+
+	for _, e := range result.Entries() {
+		var text strings.Builder
+		if e.ChangeType != "added" {
+			text.WriteString("Before: " + FormatValue(e.Before) + "\n")
+		}
+		if e.ChangeType != "removed" {
+			text.WriteString("After: " + FormatValue(e.After) + "\n")
+		}
+		add(e.Field, junitTestCase{Failure: &junitFailure{Message: e.Describe(), Type: e.ChangeType, Text: text.String()}})
+	}
+	if !driftOnly {
+		for _, field := range result.Unchanged {
+			add(field, junitTestCase{})
+		}
+	}
+	for _, field := range result.Ignored {
+		add(field, junitTestCase{Skipped: &junitSkipped{Message: "ignored by --ignore-fields"}})
+	}
+	for _, n := range result.NotVisible {
+		add(n.Field, junitTestCase{Skipped: &junitSkipped{Message: fmt.Sprintf("not readable in the %s capture", n.HiddenIn)}})
+	}
+
+	sections := make([]string, 0, len(cases))
+	for section := range cases {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	report := junitTestSuites{Name: "mm-config-diff", Suites: []junitTestSuite{}}
+	properties := []junitProperty{
+		{Name: "baseline", Value: formatSource(result.Baseline)},
+		{Name: "compared", Value: formatSource(result.Compared)},
+	}
+	for _, section := range sections {
+		suite := junitTestSuite{Name: section, Properties: properties, Cases: cases[section]}
+		sort.SliceStable(suite.Cases, func(i, j int) bool {
+			return suite.Cases[i].field < suite.Cases[j].field
+		})
+		for _, tc := range suite.Cases {
+			suite.Tests++
+			if tc.Failure != nil {
+				suite.Failures++
+			}
+			if tc.Skipped != nil {
+				suite.Skipped++
+			}
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to marshal JUnit report", err)
+	}
+	return xml.Header + string(data) + "\n", nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestFormatDiffJUnit(t *testing.T) {
+	result := sampleDiffResult()
+	result.Unchanged = []string{"ServiceSettings.EnableDeveloper"}
+	result.Ignored = []string{"ServiceSettings.SiteURL"}
+	result.NotVisible = []NotVisibleField{{Field: "SqlSettings.DriverName", Value: "postgres", HiddenIn: "compared"}}
+
+	out, err := FormatDiffJUnit(result, false)
+	if err != nil {
+		t.Fatalf("FormatDiffJUnit() error: %v", err)
+	}
+	if !strings.HasPrefix(out, "<?xml") {
+		t.Errorf("output has no XML header:\n%s", out)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("output is not valid XML: %v\n%s", err, out)
+	}
+	if report.Tests != 7 || report.Failures != 4 || report.Skipped != 2 {
+		t.Errorf("totals = %d tests, %d failures, %d skipped; want 7, 4, 2", report.Tests, report.Failures, report.Skipped)
+	}
+
+	var names []string
+	for _, s := range report.Suites {
+		names = append(names, s.Name)
+	}
+	if got := strings.Join(names, ","); got != "PluginSettings,ServiceSettings,SqlSettings,TeamSettings" {
+		t.Errorf("suites = %s", got)
+	}
+
+	service := report.Suites[1]
+	if service.Tests != 4 || service.Failures != 2 || service.Skipped != 1 {
+		t.Errorf("ServiceSettings = %d tests, %d failures, %d skipped", service.Tests, service.Failures, service.Skipped)
+	}
+	cases := make(map[string]junitTestCase)
+	for _, tc := range service.Cases {
+		if tc.ClassName != "ServiceSettings" {
+			t.Errorf("%s classname = %q", tc.Name, tc.ClassName)
+		}
+		cases[tc.Name] = tc
+	}
+	if tc := cases["EnableDeveloper"]; tc.Failure != nil || tc.Skipped != nil {
+		t.Errorf("unchanged field should pass: %+v", tc)
+	}
+	if tc := cases["SiteURL"]; tc.Skipped == nil {
+		t.Errorf("ignored field should be skipped: %+v", tc)
+	}
+	f := cases["MaximumLoginAttempts"].Failure
+	if f == nil || f.Type != "changed" || f.Message != "ServiceSettings.MaximumLoginAttempts changed from 10 to 5" || f.Text != "Before: 10\nAfter: 5\n" {
+		t.Errorf("failure = %+v", f)
+	}
+	if s := report.Suites[2].Cases[0].Skipped; s == nil || !strings.Contains(s.Message, "compared") {
+		t.Errorf("not visible field should be skipped: %+v", s)
+	}
+}
+
+func TestFormatDiffJUnitDriftOnly(t *testing.T) {
+	result := sampleDiffResult()
+	result.Unchanged = []string{"ServiceSettings.EnableDeveloper", "LogSettings.EnableConsole"}
+	result.Ignored = []string{"ServiceSettings.SiteURL"}
+
+	out, err := FormatDiffJUnit(result, true)
+	if err != nil {
+		t.Fatalf("FormatDiffJUnit() error: %v", err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("output is not valid XML: %v", err)
+	}
+	if report.Tests != 5 || report.Failures != 4 || report.Skipped != 1 {
+		t.Errorf("totals = %d tests, %d failures, %d skipped; want 5, 4, 1", report.Tests, report.Failures, report.Skipped)
+	}
+	if strings.Contains(out, "EnableDeveloper") || strings.Contains(out, "LogSettings") {
+		t.Errorf("unchanged fields should be left out:\n%s", out)
+	}
+}
+
+func TestFormatDiffJUnitEscapesValues(t *testing.T) {
+	result := &DiffResult{
+		DriftDetected: true,
+		Changed:       []ChangedField{{Field: "ServiceSettings.AllowCorsFrom", Before: "", After: `<a href="x">&`}},
+	}
+	out, err := FormatDiffJUnit(result, true)
+	if err != nil {
+		t.Fatalf("FormatDiffJUnit() error: %v", err)
+	}
+	var report junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("output is not valid XML: %v\n%s", err, out)
+	}
+	if got := report.Suites[0].Cases[0].Failure.Text; !strings.Contains(got, `<a href=\"x\">&`) {
+		t.Errorf("failure text = %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// DefaultLocalSocket is the socket path Mattermost uses for local mode
+// unless ServiceSettings.LocalModeSocketLocation says otherwise.
+const DefaultLocalSocket = "/var/tmp/mattermost_local.socket"
+
+// LocalClient talks to a Mattermost server in local mode over its Unix
+// socket. Local mode needs no credentials; access is controlled by the
+// socket's file permissions.
+type LocalClient struct {
+	client     *model.Client4
+	socketPath string
+	siteURL    string
+}
+
+// NewLocalClient creates a LocalClient for the socket at socketPath.
+func NewLocalClient(socketPath string, opts LiveClientOptions) (*LocalClient, error) {
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: local mode socket %s not found. Is ServiceSettings.EnableLocalMode enabled on this server?", socketPath), err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s is not a Unix socket", socketPath), nil)
+	}
+
+	client := model.NewAPIv4SocketClient(socketPath)
+	client.HTTPClient.Transport = newRetryTransport(client.HTTPClient.Transport, opts.MaxRetries, opts.Timeout, opts.Verbose)
+	if opts.Recorder != nil {
+		client.HTTPClient.Transport = opts.Recorder.Wrap(client.HTTPClient.Transport, "unix://"+socketPath)
+	}
+	if opts.Verbose {
+		fmt.Fprintf(os.Stderr, "Connecting to local mode socket %s...\n", socketPath)
+	}
+
+	return &LocalClient{client: client, socketPath: socketPath}, nil
+}
+
+// GetConfig retrieves the server configuration as a generic map.
+func (c *LocalClient) GetConfig(ctx context.Context) (map[string]interface{}, error) {
+	config, err := fetchConfig(ctx, c.client, "unix://"+c.socketPath)
+	if err != nil {
+		return nil, err
+	}
+	c.siteURL = siteURL(config)
+	return config, nil
+}
+
+// ServerURL returns the server's SiteURL once the config has been fetched,
+// so that local snapshots line up with remote ones of the same server.
+// Without a SiteURL it returns a unix:// URL for the socket.
+func (c *LocalClient) ServerURL() string {
+	if c.siteURL != "" {
+		return c.siteURL
+	}
+	return "unix://" + c.socketPath
+}
+
+// LocalSocket returns the socket path, recorded in snapshot metadata.
+func (c *LocalClient) LocalSocket() string {
+	return c.socketPath
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveLocalSocket serves handler on a Unix socket and returns its path.
+func serveLocalSocket(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	// Socket paths are length-limited, so avoid the long t.TempDir paths.
+	dir, err := os.MkdirTemp("", "mmsock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "mattermost_local.socket")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen on %s: %v", path, err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return path
+}
+
+func TestLocalClient_Snapshot(t *testing.T) {
+	var authHeader string
+	socket := serveLocalSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		if r.URL.Path != "/api/v4/config" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"ServiceSettings":{"SiteURL":"https://mm.example.com"},"SqlSettings":{"DataSource":"postgres://mmuser:secret@db/mattermost"}}`)
+	}))
+
+	client, err := NewLocalClient(socket, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLocalClient failed: %v", err)
+	}
+	snapshot, err := TakeSnapshot(context.Background(), client, "1.0.0")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+
+	if authHeader != "" {
+		t.Errorf("local mode should send no credentials, got %q", authHeader)
+	}
+	meta, err := snapshotMetadata(snapshot, "snapshot")
+	if err != nil {
+		t.Fatalf("snapshotMetadata failed: %v", err)
+	}
+	if meta.LocalSocket != socket {
+		t.Errorf("LocalSocket = %q, want %q", meta.LocalSocket, socket)
+	}
+	if meta.ServerURL != "https://mm.example.com" {
+		t.Errorf("ServerURL = %q, want the SiteURL", meta.ServerURL)
+	}
+	sql := snapshot["SqlSettings"].(map[string]interface{})
+	if sql["DataSource"] != RedactedValue {
+		t.Errorf("DataSource not redacted: %v", sql["DataSource"])
+	}
+}
+
+func TestLocalClient_NoSiteURL(t *testing.T) {
+	socket := serveLocalSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ServiceSettings":{}}`)
+	}))
+
+	client, err := NewLocalClient(socket, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLocalClient failed: %v", err)
+	}
+	if _, err := client.GetConfig(context.Background()); err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if client.ServerURL() != "unix://"+socket {
+		t.Errorf("ServerURL = %q", client.ServerURL())
+	}
+}
+
+func TestNewLocalClient_NotASocket(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewLocalClient(filepath.Join(dir, "missing.socket"), LiveClientOptions{}); err == nil {
+		t.Error("expected error for missing socket")
+	}
+	file := filepath.Join(dir, "plain")
+	os.WriteFile(file, nil, 0600)
+	if _, err := NewLocalClient(file, LiveClientOptions{}); err == nil {
+		t.Error("expected error for a regular file")
+	}
+}
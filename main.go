@@ -2,10 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/spf13/cobra"
 )
 
@@ -21,7 +31,29 @@ func run() int {
 		urlFlag      string
 		tokenFlag    string
 		usernameFlag string
+		storeFlag    string
+		gitRepoFlag  string
+		historyFlag  string
+		timeoutFlag  time.Duration
+		retriesFlag  int
+		tlsOpts      TLSOptions
+		proxyFlag    string
+		headerFlags  []string
+		localSocket  string
+		localFlag    bool
+		configDSN    string
+		profileFlag  string
+		credOpts     CredentialOptions
+		toolConfig   string
+		recordDir    string
+		replayDir    string
 		verbose      bool
+
+		// profile is the selected connection profile; empty if none.
+		profile     = &Profile{}
+		profileName string
+
+		s3Opts = S3OptionsFromEnv()
 	)
 
 	rootCmd := &cobra.Command{
@@ -30,22 +62,222 @@ func run() int {
 		Long:  "Detects configuration drift by capturing and comparing Mattermost instance configurations.",
 		SilenceUsage:  true,
 		SilenceErrors: true,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			// Resolve flags from environment variables.
-			urlFlag = flagOrEnv(urlFlag, "MM_URL")
-			tokenFlag = flagOrEnv(tokenFlag, "MM_TOKEN")
-			usernameFlag = flagOrEnv(usernameFlag, "MM_USERNAME")
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Select the connection profile, if any.
+			workDir, _ := os.Getwd()
+			toolCfg, err := LoadToolConfig(flagOrEnv(toolConfig, "MM_TOOL_CONFIG"), workDir)
+			if err != nil {
+				return err
+			}
+			selected, name, err := toolCfg.Profile(flagOrEnv(profileFlag, "MM_PROFILE"))
+			if err != nil {
+				return err
+			}
+			if selected != nil {
+				profile, profileName = selected, name
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Using profile %q\n", profileName)
+				}
+			}
+
+			// Resolve flags from environment variables, then the profile. A
+			// profile named with --profile takes precedence over the
+			// environment, so that exported MM_* variables for another server
+			// cannot override it.
+			explicit := cmd.Flags().Changed("profile")
+			resolve, env := flagOrEnvOrProfile, profile.Env(explicit)
+			if explicit {
+				resolve = flagOrProfileOrEnv
+			}
+			profileSocket := ""
+			if profile.Auth == AuthLocal && flagOrEnv(urlFlag, env.URL) == "" {
+				profileSocket = profile.LocalSocket
+				if profileSocket == "" {
+					profileSocket = DefaultLocalSocket
+				}
+			}
+			urlFlag = resolve(urlFlag, env.URL, profile.URL)
+			tokenFlag = flagOrEnv(tokenFlag, env.Token)
+			usernameFlag = resolve(usernameFlag, "MM_USERNAME", profile.Username)
+			credOpts.TokenFile = resolve(credOpts.TokenFile, env.TokenFile, profile.TokenFile)
+			credOpts.PasswordFile = resolve(credOpts.PasswordFile, "MM_PASSWORD_FILE", profile.PasswordFile)
+			credOpts.CredentialHelper = resolve(credOpts.CredentialHelper, "MM_CREDENTIAL_HELPER", profile.CredentialHelper)
+			storeFlag = flagOrEnv(storeFlag, "MM_STORE")
+			gitRepoFlag = flagOrEnv(gitRepoFlag, "MM_GIT_REPO")
+			historyFlag = flagOrEnv(historyFlag, "MM_HISTORY_DB")
+			localSocket = resolve(localSocket, env.LocalSocket, profileSocket)
+			if localSocket == "" && localFlag {
+				localSocket = DefaultLocalSocket
+			}
+			configDSN = flagOrEnv(configDSN, env.ConfigDSN)
+			tlsOpts.CAFile = resolve(tlsOpts.CAFile, "MM_CA_CERT", profile.CACert)
+			tlsOpts.CertFile = resolve(tlsOpts.CertFile, "MM_CLIENT_CERT", profile.ClientCert)
+			tlsOpts.KeyFile = resolve(tlsOpts.KeyFile, "MM_CLIENT_KEY", profile.ClientKey)
+
+			// Settings without environment variables fall back to the profile.
+			flags := cmd.Flags()
+			if !flags.Changed("insecure-skip-verify") {
+				tlsOpts.InsecureSkipVerify = profile.InsecureSkipVerify
+			}
+			if proxyFlag == "" {
+				proxyFlag = profile.Proxy
+			}
+			if !flags.Changed("timeout") && profile.Timeout != nil {
+				timeoutFlag = *profile.Timeout
+			}
+			if !flags.Changed("retries") && profile.Retries != nil {
+				retriesFlag = *profile.Retries
+			}
+			return nil
 		},
 	}
 
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Connection profile from the tool configuration file (env: MM_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&toolConfig, "tool-config", "", "Tool configuration file (env: MM_TOOL_CONFIG; default: "+ProjectConfigFile+" or the user config file)")
 	rootCmd.PersistentFlags().StringVar(&urlFlag, "url", "", "Mattermost server URL (env: MM_URL)")
 	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "", "Personal access token (env: MM_TOKEN)")
 	rootCmd.PersistentFlags().StringVar(&usernameFlag, "username", "", "Username for password auth (env: MM_USERNAME)")
+	rootCmd.PersistentFlags().StringVar(&credOpts.TokenFile, "token-file", "", "Read the personal access token from a file readable only by you (env: MM_TOKEN_FILE)")
+	rootCmd.PersistentFlags().BoolVar(&credOpts.TokenStdin, "token-stdin", false, "Read the personal access token from stdin")
+	rootCmd.PersistentFlags().StringVar(&credOpts.PasswordFile, "password-file", "", "Read the password from a file readable only by you (env: MM_PASSWORD_FILE)")
+	rootCmd.PersistentFlags().BoolVar(&credOpts.PasswordStdin, "password-stdin", false, "Read the password from stdin")
+	rootCmd.PersistentFlags().BoolVar(&credOpts.MFA, "mfa", false, "Prompt for the MFA code before logging in with a password (env MM_MFA_TOKEN supplies it non-interactively)")
+	rootCmd.PersistentFlags().StringVar(&credOpts.CredentialHelper, "credential-helper", "", "Git-style credential helper that supplies the token or password (env: MM_CREDENTIAL_HELPER)")
+	rootCmd.PersistentFlags().StringVar(&storeFlag, "store", "", "Snapshot store directory (env: MM_STORE)")
+	rootCmd.PersistentFlags().StringVar(&gitRepoFlag, "git-repo", "", "Git repository for snapshot history (env: MM_GIT_REPO)")
+	rootCmd.PersistentFlags().StringVar(&historyFlag, "history-db", "", "SQLite history database to record snapshots and changes in (env: MM_HISTORY_DB)")
+	rootCmd.PersistentFlags().StringVar(&s3Opts.Endpoint, "s3-endpoint", s3Opts.Endpoint, "S3-compatible endpoint URL, e.g. for MinIO (env: AWS_ENDPOINT_URL_S3)")
+	rootCmd.PersistentFlags().StringVar(&s3Opts.Region, "s3-region", s3Opts.Region, "S3 region (env: AWS_REGION)")
+	rootCmd.PersistentFlags().StringVar(&s3Opts.SSE, "s3-sse", "", "S3 server-side encryption for uploads: AES256 or aws:kms")
+	rootCmd.PersistentFlags().StringVar(&s3Opts.KMSKeyID, "s3-sse-kms-key-id", "", "KMS key ID for aws:kms server-side encryption")
+	rootCmd.PersistentFlags().StringVar(&s3Opts.ObjectLockMode, "s3-object-lock-mode", "", "S3 object lock mode for uploads: GOVERNANCE or COMPLIANCE")
+	rootCmd.PersistentFlags().IntVar(&s3Opts.ObjectLockRetainDays, "s3-object-lock-retain-days", 0, "Days to retain uploads under object lock")
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", DefaultTimeout, "Timeout for each API request, e.g. 30s or 2m (0 disables)")
+	rootCmd.PersistentFlags().IntVar(&retriesFlag, "retries", DefaultMaxRetries, "Retries for API requests that fail with connection errors, 5xx or 429 responses")
+	rootCmd.PersistentFlags().StringVar(&localSocket, "local-socket", "", "Connect through the local mode Unix socket instead of --url; no credentials needed (env: MM_LOCAL_SOCKET)")
+	rootCmd.PersistentFlags().BoolVar(&localFlag, "local", false, "Connect through the local mode Unix socket at --local-socket, or the default socket if unset")
+	rootCmd.PersistentFlags().StringVar(&configDSN, "config-dsn", "", "Read config from the database Configurations table instead of the API (env: MM_CONFIG_DSN)")
+	rootCmd.PersistentFlags().StringVar(&tlsOpts.CAFile, "ca-cert", "", "PEM CA bundle to trust for the server certificate (env: MM_CA_CERT)")
+	rootCmd.PersistentFlags().StringVar(&tlsOpts.CertFile, "client-cert", "", "PEM client certificate for mutual TLS (env: MM_CLIENT_CERT)")
+	rootCmd.PersistentFlags().StringVar(&tlsOpts.KeyFile, "client-key", "", "PEM private key for --client-cert (env: MM_CLIENT_KEY)")
+	rootCmd.PersistentFlags().BoolVar(&tlsOpts.InsecureSkipVerify, "insecure-skip-verify", false, "Disable TLS certificate verification (unsafe; for testing only)")
+	rootCmd.PersistentFlags().StringVar(&proxyFlag, "proxy", "", "HTTP(S) proxy URL (default: HTTPS_PROXY/HTTP_PROXY/NO_PROXY)")
+	rootCmd.PersistentFlags().StringArrayVar(&headerFlags, "header", nil, "Extra request header as \"Name: value\" (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "Record the API exchanges, scrubbed of credentials and secrets, to a directory for --replay")
+	rootCmd.PersistentFlags().StringVar(&replayDir, "replay", "", "Serve API responses from a directory written by --record instead of contacting a server")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging to stderr")
 
 	rootCmd.Version = version
 	rootCmd.SetVersionTemplate("mm-config-diff version {{.Version}}\n")
 
+	// storageBackends returns the backends for remote storage URIs.
+	// The S3 options are only validated when one of the given references
+	// is an s3:// URI.
+	storageBackends := func(refs ...string) (StorageBackends, error) {
+		backends := StorageBackends{}
+		for _, ref := range refs {
+			if !IsStorageURI(ref) {
+				continue
+			}
+			// S3 shares the proxy and trusted CAs, but never the Mattermost
+			// client certificate or disabled verification.
+			transport, err := newHTTPTransport(TLSOptions{CAFile: tlsOpts.CAFile}, proxyFlag)
+			if err != nil {
+				return nil, err
+			}
+			opts := s3Opts
+			opts.HTTPClient = &http.Client{Transport: transport, Timeout: timeoutFlag}
+			s3, err := NewS3Backend(opts)
+			if err != nil {
+				return nil, err
+			}
+			backends["s3"] = s3
+			break
+		}
+		return backends, nil
+	}
+
+	// clientOptions returns the LiveClient options from the global flags.
+	var recorder *Recorder
+	clientOptions := func() (LiveClientOptions, error) {
+		headers, err := ParseHeaders(headerFlags)
+		if err != nil {
+			return LiveClientOptions{}, err
+		}
+		if recordDir != "" && recorder == nil {
+			if recorder, err = NewRecorder(recordDir, version); err != nil {
+				return LiveClientOptions{}, err
+			}
+		}
+		// Profile headers apply unless a flag sets the same header.
+		for name, value := range profile.Headers {
+			if _, ok := headers[name]; !ok {
+				if headers == nil {
+					headers = make(map[string]string)
+				}
+				headers[name] = value
+			}
+		}
+		return LiveClientOptions{
+			Timeout:    timeoutFlag,
+			MaxRetries: retriesFlag,
+			TLS:        tlsOpts,
+			ProxyURL:   proxyFlag,
+			Headers:    headers,
+			Recorder:   recorder,
+			Verbose:    verbose,
+		}, nil
+	}
+
+	// credentials resolves the credential sources once, so that a secret
+	// read from stdin or a prompt serves every connection of the command.
+	var resolvedCreds *Credentials
+	credentials := func() (Credentials, error) {
+		if resolvedCreds == nil {
+			credOpts.Token, credOpts.Username = tokenFlag, usernameFlag
+			creds, err := ResolveCredentials(credOpts, os.Stdin)
+			if err != nil {
+				return Credentials{}, err
+			}
+			creds = creds.Reusable()
+			resolvedCreds = &creds
+		}
+		return *resolvedCreds, nil
+	}
+
+	// connect returns a client for a recording, the config database, the
+	// local mode socket or the server URL. missingURL is the error message
+	// used when none is set.
+	connect := func(ctx context.Context, missingURL string) (MattermostClient, error) {
+		if replayDir != "" {
+			if recordDir != "" {
+				return nil, &ExitError{Code: ExitConfigError, Message: "error: --record and --replay cannot be used together."}
+			}
+			return NewReplayClient(replayDir)
+		}
+		if configDSN != "" {
+			if recordDir != "" {
+				return nil, &ExitError{Code: ExitConfigError, Message: "error: --record cannot be used with --config-dsn; only API exchanges can be recorded."}
+			}
+			return NewDBClient(ctx, configDSN)
+		}
+		opts, err := clientOptions()
+		if err != nil {
+			return nil, err
+		}
+		if localSocket != "" {
+			return NewLocalClient(localSocket, opts)
+		}
+		if urlFlag == "" {
+			return nil, &ExitError{Code: ExitConfigError, Message: missingURL}
+		}
+		creds, err := credentials()
+		if err != nil {
+			return nil, err
+		}
+		return NewLiveClient(ctx, urlFlag, creds, opts)
+	}
+
 	// --- Snapshot subcommand ---
 	var snapshotOutput string
 
@@ -53,27 +285,80 @@ func run() int {
 		Use:   "snapshot",
 		Short: "Capture a point-in-time configuration snapshot",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if urlFlag == "" {
-				return &ExitError{Code: ExitConfigError, Message: "error: server URL is required. Use --url or set the MM_URL environment variable."}
-			}
-
-			ctx := context.Background()
-			client, err := NewLiveClient(ctx, urlFlag, tokenFlag, usernameFlag, verbose)
+			ctx := cmd.Context()
+			client, err := connect(ctx, "error: server URL is required. Use --url or set the MM_URL environment variable, or use --local-socket on the server host.")
 			if err != nil {
 				return err
 			}
+			defer closeClient(client)
 
 			snapshot, err := TakeSnapshot(ctx, client, version)
 			if err != nil {
 				return err
 			}
 
+			if historyFlag != "" {
+				db, err := OpenHistoryDB(historyFlag)
+				if err != nil {
+					return err
+				}
+				count, err := db.IngestSnapshot(snapshot)
+				db.Close()
+				if err != nil {
+					return err
+				}
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Recorded snapshot in %s (%d change(s) since the previous snapshot)\n", historyFlag, count)
+				}
+			}
+
+			if gitRepoFlag != "" {
+				history, err := OpenGitHistory(gitRepoFlag, verbose)
+				if err != nil {
+					return err
+				}
+				committed, commitID, err := history.Commit(snapshot)
+				if err != nil {
+					return err
+				}
+				if committed {
+					fmt.Fprintf(os.Stderr, "Committed snapshot to %s (%s)\n", gitRepoFlag, commitID)
+				} else {
+					fmt.Fprintf(os.Stderr, "Configuration unchanged; nothing committed to %s\n", gitRepoFlag)
+				}
+				// The repository is the record unless a file or store was also requested.
+				if storeFlag == "" && snapshotOutput == "" {
+					return nil
+				}
+			}
+
+			if storeFlag != "" && snapshotOutput == "" {
+				store, err := CreateStore(storeFlag)
+				if err != nil {
+					return err
+				}
+				entry, err := store.Add(snapshot)
+				if err != nil {
+					return err
+				}
+				absPath, err := filepath.Abs(store.Path(*entry))
+				if err != nil {
+					absPath = store.Path(*entry)
+				}
+				fmt.Println(absPath)
+				return nil
+			}
+
 			outputPath := snapshotOutput
 			if outputPath == "" {
 				outputPath = DefaultSnapshotFilename()
 			}
 
-			absPath, err := WriteSnapshot(snapshot, outputPath)
+			backends, err := storageBackends(outputPath)
+			if err != nil {
+				return err
+			}
+			absPath, err := WriteSnapshotTo(ctx, backends, snapshot, outputPath)
 			if err != nil {
 				return err
 			}
@@ -83,16 +368,26 @@ func run() int {
 		},
 	}
 
-	snapshotCmd.Flags().StringVar(&snapshotOutput, "output", "", "Output file path (default: mm-config-snapshot-{TIMESTAMP}.json)")
+	snapshotCmd.Flags().StringVar(&snapshotOutput, "output", "", "Output file path or s3:// URI (default: mm-config-snapshot-{TIMESTAMP}.json, or into --store when set)")
 	rootCmd.AddCommand(snapshotCmd)
 
 	// --- Diff subcommand ---
 	var (
-		diffBaseline     string
-		diffAgainst      string
-		diffIgnoreFields string
-		diffFormat       string
-		diffOutput       string
+		diffBaseline       string
+		diffAgainst        string
+		diffIgnoreFields   string
+		diffFormat         string
+		diffOutput         string
+		diffJUnitCases     string
+		diffColor          string
+		diffSideBySide     bool
+		diffTemplate       string
+		diffSummary        bool
+		diffDepth          int
+		diffSyslog         string
+		diffSyslogCA       string
+		diffSyslogInsecure bool
+		diffRunID          string
 	)
 
 	diffCmd := &cobra.Command{
@@ -102,47 +397,66 @@ func run() int {
 			if diffBaseline == "" {
 				return &ExitError{Code: ExitConfigError, Message: "error: --baseline is required."}
 			}
+			if !cmd.Flags().Changed("format") && profile.Format != "" {
+				diffFormat = profile.Format
+			}
+			if !cmd.Flags().Changed("ignore-fields") && len(profile.IgnoreFields) > 0 {
+				diffIgnoreFields = strings.Join(profile.IgnoreFields, ",")
+			}
+			if diffSummary && diffFormat != "text" && diffFormat != "json" {
+				return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: --summary supports the 'text' and 'json' formats, not %q.", diffFormat)}
+			}
+			if cmd.Flags().Changed("depth") && !diffSummary {
+				return &ExitError{Code: ExitConfigError, Message: "error: --depth requires --summary."}
+			}
+			if diffDepth < 1 {
+				return &ExitError{Code: ExitConfigError, Message: "error: --depth must be 1 or more."}
+			}
+			if diffSyslog != "" {
+				if _, _, err := parseSyslogURL(diffSyslog); err != nil {
+					return err
+				}
+			}
 
-			baselineConfig, baselineMeta, err := LoadSnapshot(diffBaseline)
+			ctx := cmd.Context()
+			backends, err := storageBackends(diffBaseline, diffAgainst, diffOutput)
 			if err != nil {
 				return err
 			}
+			sources := SnapshotSources{StoreDir: storeFlag, GitRepo: gitRepoFlag, Backends: backends, Verbose: verbose}
 
 			var targetConfig map[string]interface{}
+			var targetMeta *SnapshotMetadata
 			var comparedSource DiffSource
+			comparedAt := time.Now()
 
 			if diffAgainst != "" {
 				// Two-file comparison — no API needed.
-				var targetMeta *SnapshotMetadata
-				targetConfig, targetMeta, err = LoadSnapshot(diffAgainst)
+				targetConfig, targetMeta, comparedSource, err = LoadSnapshotRef(ctx, diffAgainst, sources)
 				if err != nil {
 					return err
 				}
-				comparedSource = DiffSource{
-					File:       filepath.Base(diffAgainst),
-					Source:     "file",
-					CapturedAt: targetMeta.CapturedAt,
+				if t, err := time.Parse(time.RFC3339, targetMeta.CapturedAt); err == nil {
+					comparedAt = t
 				}
 			} else {
 				// Live comparison — requires API.
-				if urlFlag == "" {
-					return &ExitError{Code: ExitConfigError, Message: "error: server URL is required for live comparison. Use --url or set MM_URL, or use --against to compare two snapshot files."}
-				}
-
-				ctx := context.Background()
-				client, err := NewLiveClient(ctx, urlFlag, tokenFlag, usernameFlag, verbose)
+				client, err := connect(ctx, "error: server URL is required for live comparison. Use --url or set MM_URL, or use --against to compare two snapshot files.")
 				if err != nil {
 					return err
 				}
+				defer closeClient(client)
 
-				liveConfig, err := client.GetConfig(ctx)
+				// A snapshot records what the account could read.
+				liveConfig, err := TakeSnapshot(ctx, client, version)
 				if err != nil {
 					return err
 				}
 
-				RedactConfig(liveConfig)
-
 				targetConfig = liveConfig
+				if targetMeta, err = snapshotMetadata(liveConfig, "live"); err != nil {
+					return err
+				}
 				comparedSource = DiffSource{
 					Source:     "live",
 					ServerURL:  client.ServerURL(),
@@ -150,34 +464,177 @@ func run() int {
 				}
 			}
 
+			// Store references such as latest pick the compared server's
+			// snapshots, in a store shared by several servers.
+			sources.ServerURL = targetMeta.ServerURL
+			baselineConfig, baselineMeta, baselineSource, err := LoadSnapshotRef(ctx, diffBaseline, sources)
+			if err != nil {
+				return err
+			}
+
+			// Recorded in the history database, if enabled.
+			serverURL := targetMeta.ServerURL
+			if serverURL == "" {
+				serverURL = baselineMeta.ServerURL
+			}
+
 			ignoreFields := ParseIgnoreFields(diffIgnoreFields)
 			result := CompareConfigs(baselineConfig, targetConfig, ignoreFields)
 
-			result.Baseline = DiffSource{
-				File:       filepath.Base(diffBaseline),
-				Source:     "file",
-				CapturedAt: baselineMeta.CapturedAt,
-			}
+			result.Baseline = baselineSource
 			result.Compared = comparedSource
 
-			var output string
-			switch diffFormat {
-			case "json":
-				output, err = FormatDiffJSON(result)
-				if err != nil {
+			runID := diffRunID
+			if runID == "" {
+				runID = NewRunID()
+			}
+			events := NewDriftEvents(result, serverURL, runID, time.Now())
+			if diffSyslog != "" {
+				if err := CheckSyslogEvents(diffSyslog, events, diffFormat == "cef", version); err != nil {
 					return err
 				}
-				output += "\n"
-			case "text":
-				output = FormatDiffText(result)
-			default:
-				return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: unsupported format %q. Use 'text' or 'json'.", diffFormat)}
 			}
 
-			if err := WriteOutput(output, diffOutput); err != nil {
+			var output, contentType string
+			if diffSummary {
+				summary := SummarizeDiff(result, diffDepth)
+				if diffFormat == "json" {
+					output, err = FormatSummaryJSON(summary)
+					if err != nil {
+						return err
+					}
+					output += "\n"
+					contentType = "application/json"
+				} else {
+					output = FormatSummaryText(summary)
+					contentType = "text/plain; charset=utf-8"
+				}
+			} else {
+				switch diffFormat {
+				case "json":
+					output, err = FormatDiffJSON(result)
+					if err != nil {
+						return err
+					}
+					output += "\n"
+					contentType = "application/json"
+				case "text":
+					tty, width := StdoutTerminal()
+					if diffOutput != "" {
+						tty, width = false, 0
+					}
+					color, err := UseColor(diffColor, tty)
+					if err != nil {
+						return err
+					}
+					output = FormatDiffTextWith(result, TextOptions{Color: color, SideBySide: diffSideBySide, Width: width})
+					contentType = "text/plain; charset=utf-8"
+				case "markdown":
+					output = FormatDiffMarkdown(result)
+					contentType = "text/markdown; charset=utf-8"
+				case "html":
+					output, err = FormatDiffHTML(result)
+					if err != nil {
+						return err
+					}
+					contentType = "text/html; charset=utf-8"
+				case "sarif":
+					uri, data := SARIFBaseline(diffBaseline, baselineSource, baselineConfig)
+					output, err = FormatDiffSARIF(result, uri, data, version)
+					if err != nil {
+						return err
+					}
+					contentType = "application/sarif+json"
+				case "junit":
+					if diffJUnitCases != "all" && diffJUnitCases != "drifted" {
+						return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: unsupported --junit-cases %q. Use 'all' or 'drifted'.", diffJUnitCases)}
+					}
+					output, err = FormatDiffJUnit(result, diffJUnitCases == "drifted")
+					if err != nil {
+						return err
+					}
+					contentType = "application/xml"
+				case "json-patch":
+					output, err = FormatDiffJSONPatch(result, baselineConfig, targetConfig)
+					if err != nil {
+						return err
+					}
+					contentType = "application/json-patch+json"
+				case "merge-patch":
+					output, err = FormatDiffMergePatch(result, baselineConfig, targetConfig)
+					if err != nil {
+						return err
+					}
+					contentType = "application/merge-patch+json"
+				case "template":
+					if diffTemplate == "" {
+						return &ExitError{Code: ExitConfigError, Message: "error: --format template requires --template."}
+					}
+					tmpl, err := LoadReportTemplate(diffTemplate)
+					if err != nil {
+						return err
+					}
+					output, err = FormatDiffTemplate(tmpl, NewTemplateData(result, baselineMeta, targetMeta))
+					if err != nil {
+						return err
+					}
+					contentType = templateContentType(tmpl)
+				case "jsonl":
+					output, err = FormatDiffJSONLines(events)
+					if err != nil {
+						return err
+					}
+					contentType = "application/x-ndjson"
+				case "cef":
+					output = FormatDiffCEF(events, version)
+					contentType = "text/plain; charset=utf-8"
+				case "prometheus":
+					output = FormatDiffPrometheus(result, serverURL, profileName, time.Now())
+					contentType = PrometheusContentType
+				default:
+					return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: unsupported format %q. Use 'text', 'json', 'markdown', 'html', 'sarif', 'junit', 'json-patch', 'merge-patch', 'template', 'prometheus', 'jsonl' or 'cef'.", diffFormat)}
+				}
+			}
+
+			if diffFormat == "prometheus" && diffOutput != "" && !IsStorageURI(diffOutput) {
+				// The textfile collector may read the file at any moment.
+				if err := WriteTextfile(output, diffOutput); err != nil {
+					return err
+				}
+			} else if err := WriteOutputTo(ctx, backends, output, diffOutput, contentType); err != nil {
 				return err
 			}
 
+			if diffSyslog != "" && len(events) > 0 {
+				w, err := DialSyslog(ctx, diffSyslog, TLSOptions{CAFile: diffSyslogCA, InsecureSkipVerify: diffSyslogInsecure}, timeoutFlag)
+				if err != nil {
+					return err
+				}
+				err = SendDriftEvents(ctx, w, events, diffFormat == "cef", version)
+				w.Close()
+				if err != nil {
+					return err
+				}
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Sent %d event(s) to %s with run ID %s\n", len(events), diffSyslog, runID)
+				}
+			}
+
+			if historyFlag != "" {
+				db, err := OpenHistoryDB(historyFlag)
+				if err != nil {
+					return err
+				}
+				count, err := db.RecordDiff(result, serverURL, comparedAt)
+				db.Close()
+				if err != nil {
+					return err
+				}
+				if verbose {
+					fmt.Fprintf(os.Stderr, "Recorded %d change(s) in %s\n", count, historyFlag)
+				}
+			}
+
 			if result.DriftDetected {
 				return &ExitError{Code: ExitDriftFound, Message: ""}
 			}
@@ -186,15 +643,625 @@ func run() int {
 		},
 	}
 
-	diffCmd.Flags().StringVar(&diffBaseline, "baseline", "", "Path to the baseline snapshot file (required)")
-	diffCmd.Flags().StringVar(&diffAgainst, "against", "", "Path to a second snapshot to compare against (default: live instance)")
+	diffCmd.Flags().StringVar(&diffBaseline, "baseline", "", "Baseline snapshot file, store reference (latest, latest~3, 2025-10-01) or git revision (rev:path) (required)")
+	diffCmd.Flags().StringVar(&diffAgainst, "against", "", "Second snapshot file, store reference or git revision to compare against (default: live instance)")
 	diffCmd.Flags().StringVar(&diffIgnoreFields, "ignore-fields", "", "Comma-separated dot-notation field paths to exclude from comparison")
-	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Output format: text, json")
-	diffCmd.Flags().StringVar(&diffOutput, "output", "", "Write output to file (default: stdout)")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Output format: text, json, markdown, html, sarif, junit, json-patch, merge-patch, template, prometheus, jsonl, cef")
+	diffCmd.Flags().StringVar(&diffOutput, "output", "", "Write output to a file or s3:// URI (default: stdout)")
+	diffCmd.Flags().BoolVar(&diffSummary, "summary", false, "Show counts of drifted fields per section instead of every field")
+	diffCmd.Flags().IntVar(&diffDepth, "depth", 1, "With --summary, group by paths of this many levels (1: top-level sections)")
+	diffCmd.Flags().StringVar(&diffTemplate, "template", "", "Go template file, or bundled template name, for --format template")
+	diffCmd.Flags().StringVar(&diffColor, "color", "auto", "Colour text output: auto (when writing to a terminal and NO_COLOR is unset), always, never")
+	diffCmd.Flags().BoolVar(&diffSideBySide, "side-by-side", false, "Show before and after values side by side in text output")
+	diffCmd.Flags().StringVar(&diffJUnitCases, "junit-cases", "all", "JUnit test cases: all compared fields, or only drifted ones (all, drifted)")
+	diffCmd.Flags().StringVar(&diffSyslog, "syslog", "", "Also send an RFC 5424 syslog message per drifted field to udp://, tcp:// or tls://host:port")
+	diffCmd.Flags().StringVar(&diffSyslogCA, "syslog-ca-cert", "", "PEM CA bundle to trust for a tls:// syslog server")
+	diffCmd.Flags().BoolVar(&diffSyslogInsecure, "syslog-insecure-skip-verify", false, "Disable certificate verification of a tls:// syslog server (unsafe; for testing only)")
+	diffCmd.Flags().StringVar(&diffRunID, "run-id", "", "Correlation ID for the drift events of this run (default: a random UUID)")
 	rootCmd.AddCommand(diffCmd)
 
+	var (
+		listenAddr    string
+		listenTLSCert string
+		listenTLSKey  string
+	)
+
+	syslogListenCmd := &cobra.Command{
+		Use:   "syslog-listen",
+		Short: "Print syslog messages received on a local address, for testing --syslog",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var tlsConfig *tls.Config
+			if listenTLSCert != "" || listenTLSKey != "" {
+				cert, err := tls.LoadX509KeyPair(listenTLSCert, listenTLSKey)
+				if err != nil {
+					return NewExitError(ExitConfigError, "error: unable to load --tls-cert and --tls-key", err)
+				}
+				tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+			}
+			listener, err := ListenSyslog(listenAddr, tlsConfig)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Listening on %s (%s); press Ctrl-C to stop\n", listenAddr, listener.Addr())
+
+			go func() {
+				<-cmd.Context().Done()
+				listener.Close()
+			}()
+			return listener.Serve(func(msg string) {
+				fmt.Println(msg)
+			})
+		},
+	}
+	syslogListenCmd.Flags().StringVar(&listenAddr, "listen", "udp://127.0.0.1:5514", "Address to listen on: udp://, tcp:// or tls://host:port")
+	syslogListenCmd.Flags().StringVar(&listenTLSCert, "tls-cert", "", "PEM server certificate for a tls:// listener")
+	syslogListenCmd.Flags().StringVar(&listenTLSKey, "tls-key", "", "PEM private key for --tls-cert")
+	rootCmd.AddCommand(syslogListenCmd)
+
+	// --- Cluster subcommand ---
+	var (
+		clusterNodes        []string
+		clusterIgnoreFields string
+		clusterFormat       string
+		clusterOutput       string
+	)
+
+	clusterCmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Check that every node of a cluster runs the same configuration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configDSN != "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: cluster reads node status through the API and cannot be used with --config-dsn."}
+			}
+			if clusterFormat != "text" && clusterFormat != "json" {
+				return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: unsupported format %q. Use 'text' or 'json'.", clusterFormat)}
+			}
+			if !cmd.Flags().Changed("ignore-fields") && len(profile.IgnoreFields) > 0 {
+				clusterIgnoreFields = strings.Join(profile.IgnoreFields, ",")
+			}
+
+			if len(clusterNodes) > 0 && (replayDir != "" || configDSN != "") {
+				return &ExitError{Code: ExitConfigError, Message: "error: --nodes cannot be used with --replay or --config-dsn; it connects to each node over the API."}
+			}
+
+			ctx := cmd.Context()
+			opts, err := clientOptions()
+			if err != nil {
+				return err
+			}
+
+			// The cluster status comes from --url or the local socket, or
+			// else from the first of --nodes.
+			var statusClient MattermostClient
+			if urlFlag != "" || localSocket != "" || replayDir != "" || len(clusterNodes) == 0 {
+				statusClient, err = connect(ctx, "error: server URL is required. Use --url or set MM_URL, --local-socket on the server host, or --nodes.")
+				if err != nil {
+					return err
+				}
+				defer closeClient(statusClient)
+			}
+
+			var nodeConfigs []NodeConfig
+			if len(clusterNodes) > 0 {
+				creds, err := credentials()
+				if err != nil {
+					return err
+				}
+
+				for _, addr := range clusterNodes {
+					addr = strings.TrimRight(addr, "/")
+					if verbose {
+						fmt.Fprintf(os.Stderr, "Fetching configuration from node %s...\n", addr)
+					}
+					client, err := NewLiveClient(ctx, addr, creds, opts)
+					if err != nil {
+						// Bad credentials or options fail for every node alike.
+						var exitErr *ExitError
+						if errors.As(err, &exitErr) && exitErr.Code == ExitConfigError {
+							return err
+						}
+						nodeConfigs = append(nodeConfigs, NodeConfig{Address: addr, Err: err})
+						continue
+					}
+					defer closeClient(client)
+					if statusClient == nil {
+						statusClient = client
+					}
+					config, err := client.GetConfig(ctx)
+					if err == nil {
+						RedactConfig(config)
+					}
+					nodeConfigs = append(nodeConfigs, NodeConfig{Address: addr, Config: config, Err: err})
+				}
+			}
+
+			var infos []*model.ClusterInfo
+			serverURL := ""
+			if sc, ok := statusClient.(ClusterStatusClient); ok {
+				serverURL = statusClient.ServerURL()
+				infos, err = sc.ClusterStatus(ctx)
+				if err != nil {
+					if len(clusterNodes) == 0 {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "warning: unable to read cluster status from %s: %v\n", serverURL, err)
+					serverURL = ""
+				}
+			}
+
+			report := NewClusterReport(serverURL, infos, CompareNodeConfigs(nodeConfigs, ParseIgnoreFields(clusterIgnoreFields)))
+
+			var output string
+			if clusterFormat == "json" {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return NewExitError(ExitOutputError, "error: failed to marshal cluster report to JSON", err)
+				}
+				output = string(data) + "\n"
+			} else {
+				output = FormatClusterText(report)
+			}
+			if err := WriteOutput(output, clusterOutput); err != nil {
+				return err
+			}
+
+			if !report.Consistent {
+				return &ExitError{Code: ExitDriftFound, Message: ""}
+			}
+			return nil
+		},
+	}
+
+	clusterCmd.Flags().StringSliceVar(&clusterNodes, "nodes", nil, "Comma-separated node URLs to fetch and compare configurations from directly, bypassing the load balancer")
+	clusterCmd.Flags().StringVar(&clusterIgnoreFields, "ignore-fields", "", "Comma-separated dot-notation field paths to exclude from node comparison")
+	clusterCmd.Flags().StringVar(&clusterFormat, "format", "text", "Output format: text, json")
+	clusterCmd.Flags().StringVar(&clusterOutput, "output", "", "Write output to file (default: stdout)")
+	rootCmd.AddCommand(clusterCmd)
+
+	// --- Ingest subcommand ---
+	ingestCmd := &cobra.Command{
+		Use:   "ingest <snapshot>...",
+		Short: "Record existing snapshots in the history database",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if historyFlag == "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: history database is required. Use --history-db or set the MM_HISTORY_DB environment variable."}
+			}
+
+			ctx := cmd.Context()
+			backends, err := storageBackends(args...)
+			if err != nil {
+				return err
+			}
+			sources := SnapshotSources{StoreDir: storeFlag, GitRepo: gitRepoFlag, Backends: backends, Verbose: verbose}
+
+			// Load everything first so snapshots are ingested in capture order.
+			snapshots := make([]map[string]interface{}, 0, len(args))
+			for _, ref := range args {
+				config, _, _, err := LoadSnapshotRef(ctx, ref, sources)
+				if err != nil {
+					return err
+				}
+				snapshots = append(snapshots, config)
+			}
+			sort.SliceStable(snapshots, func(i, j int) bool {
+				return snapshotTime(snapshots[i]).Before(snapshotTime(snapshots[j]))
+			})
+
+			db, err := OpenHistoryDB(historyFlag)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			total := 0
+			for _, snapshot := range snapshots {
+				count, err := db.IngestSnapshot(snapshot)
+				if err != nil {
+					return err
+				}
+				total += count
+			}
+			fmt.Fprintf(os.Stderr, "Ingested %d snapshot(s); %d change(s) recorded.\n", len(snapshots), total)
+			return nil
+		},
+	}
+	rootCmd.AddCommand(ingestCmd)
+
+	// --- DB import subcommand ---
+	var importOutputDir string
+
+	dbImportCmd := &cobra.Command{
+		Use:   "db-import",
+		Short: "Import historical rows of the database Configurations table as snapshots",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configDSN == "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: database DSN is required. Use --config-dsn or set the MM_CONFIG_DSN environment variable."}
+			}
+			if recordDir != "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: --record cannot be used with --config-dsn; only API exchanges can be recorded."}
+			}
+			if storeFlag == "" && gitRepoFlag == "" && historyFlag == "" && importOutputDir == "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: nowhere to import to. Use --store, --git-repo, --history-db or --output-dir."}
+			}
+
+			ctx := cmd.Context()
+			client, err := NewDBClient(ctx, configDSN)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			rows, err := client.History(ctx)
+			if err != nil {
+				return err
+			}
+			snapshots := make([]map[string]interface{}, 0, len(rows))
+			for _, row := range rows {
+				snapshots = append(snapshots, client.RowSnapshot(row, version))
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Read %d configuration row(s) from %s\n", len(rows), client.ServerURL())
+			}
+
+			if historyFlag != "" {
+				db, err := OpenHistoryDB(historyFlag)
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				total := 0
+				for _, snapshot := range snapshots {
+					count, err := db.IngestSnapshot(snapshot)
+					if err != nil {
+						return err
+					}
+					total += count
+				}
+				fmt.Fprintf(os.Stderr, "Ingested %d snapshot(s) into %s; %d change(s) recorded.\n", len(snapshots), historyFlag, total)
+			}
+
+			if gitRepoFlag != "" {
+				history, err := OpenGitHistory(gitRepoFlag, verbose)
+				if err != nil {
+					return err
+				}
+				// Only rows newer than the repository's head are committed, so
+				// that re-running an import does not rewind the history.
+				var head time.Time
+				if _, meta, err := history.Load("HEAD", ""); err == nil {
+					head, _ = time.Parse(time.RFC3339, meta.CapturedAt)
+				}
+				commits := 0
+				for _, snapshot := range snapshots {
+					if !snapshotTime(snapshot).After(head) {
+						continue
+					}
+					committed, _, err := history.Commit(snapshot)
+					if err != nil {
+						return err
+					}
+					if committed {
+						commits++
+					}
+				}
+				fmt.Fprintf(os.Stderr, "Committed %d snapshot(s) to %s\n", commits, gitRepoFlag)
+			}
+
+			if storeFlag != "" {
+				store, err := CreateStore(storeFlag)
+				if err != nil {
+					return err
+				}
+				existing := make(map[string]bool)
+				for _, e := range store.Entries() {
+					existing[e.ServerURL+" "+e.CapturedAt] = true
+				}
+				added := 0
+				for _, snapshot := range snapshots {
+					meta, _ := snapshot["_metadata"].(map[string]interface{})
+					if existing[stringFromMap(meta, "server_url")+" "+stringFromMap(meta, "captured_at")] {
+						continue
+					}
+					if _, err := store.Add(snapshot); err != nil {
+						return err
+					}
+					added++
+				}
+				fmt.Fprintf(os.Stderr, "Added %d snapshot(s) to %s\n", added, storeFlag)
+			}
+
+			if importOutputDir != "" {
+				if err := os.MkdirAll(importOutputDir, 0755); err != nil {
+					return NewExitError(ExitOutputError, fmt.Sprintf("error: unable to create directory %s", importOutputDir), err)
+				}
+				for _, snapshot := range snapshots {
+					name := strings.ReplaceAll(snapshotTime(snapshot).UTC().Format(time.RFC3339), ":", "-")
+					absPath, err := WriteSnapshot(snapshot, filepath.Join(importOutputDir, "mm-config-snapshot-"+name+".json"))
+					if err != nil {
+						return err
+					}
+					fmt.Println(absPath)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	dbImportCmd.Flags().StringVar(&importOutputDir, "output-dir", "", "Directory to write the imported snapshot files to")
+
+	rootCmd.AddCommand(dbImportCmd)
+
+	// --- Profiles subcommand ---
+	profilesCmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List the connection profiles in the tool configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workDir, _ := os.Getwd()
+			toolCfg, err := LoadToolConfig(flagOrEnv(toolConfig, "MM_TOOL_CONFIG"), workDir)
+			if err != nil {
+				return err
+			}
+			if len(toolCfg.Files) == 0 {
+				fmt.Fprintf(os.Stderr, "No tool configuration file found. Create %s or %s.\n", UserConfigPath(), ProjectConfigFile)
+				return nil
+			}
+			fmt.Print(FormatProfileList(toolCfg, profileName))
+			return nil
+		},
+	}
+
+	rootCmd.AddCommand(profilesCmd)
+
+	// --- Query subcommand ---
+	var (
+		queryPath     string
+		querySince    string
+		queryUntil    string
+		queryServer   string
+		queryType     string
+		querySeverity string
+		queryFormat   string
+		queryOutput   string
+	)
+
+	queryCmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query recorded configuration changes in the history database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if historyFlag == "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: history database is required. Use --history-db or set the MM_HISTORY_DB environment variable."}
+			}
+
+			since, err := ParseHistoryTime(querySince, false)
+			if err != nil {
+				return err
+			}
+			until, err := ParseHistoryTime(queryUntil, true)
+			if err != nil {
+				return err
+			}
+
+			db, err := OpenHistoryDB(historyFlag)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			changes, err := db.Query(HistoryQuery{
+				Path:       queryPath,
+				Since:      since,
+				Until:      until,
+				ServerURL:  queryServer,
+				ChangeType: queryType,
+				Severity:   querySeverity,
+			})
+			if err != nil {
+				return err
+			}
+
+			var output string
+			switch queryFormat {
+			case "json":
+				data, err := json.MarshalIndent(changes, "", "  ")
+				if err != nil {
+					return NewExitError(ExitOutputError, "error: failed to marshal query result to JSON", err)
+				}
+				output = string(data) + "\n"
+			case "text":
+				output = FormatHistoryText(changes)
+			default:
+				return &ExitError{Code: ExitConfigError, Message: fmt.Sprintf("error: unsupported format %q. Use 'text' or 'json'.", queryFormat)}
+			}
+
+			return WriteOutput(output, queryOutput)
+		},
+	}
+
+	queryCmd.Flags().StringVar(&queryPath, "path", "", "Dot-notation path prefix or glob pattern, e.g. PasswordSettings or 'ServiceSettings.*Session*'")
+	queryCmd.Flags().StringVar(&querySince, "since", "", "Only changes detected on or after this date or timestamp")
+	queryCmd.Flags().StringVar(&queryUntil, "until", "", "Only changes detected on or before this date or timestamp")
+	queryCmd.Flags().StringVar(&queryServer, "server", "", "Only changes on this server URL")
+	queryCmd.Flags().StringVar(&queryType, "type", "", "Only changes of this type: changed, added, removed")
+	queryCmd.Flags().StringVar(&querySeverity, "severity", "", "Only changes of this severity: high, medium, low")
+	queryCmd.Flags().StringVar(&queryFormat, "format", "text", "Output format: text, json")
+	queryCmd.Flags().StringVar(&queryOutput, "output", "", "Write output to file (default: stdout)")
+	rootCmd.AddCommand(queryCmd)
+
+	// --- Store subcommand ---
+	storeCmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage a local snapshot store",
+	}
+
+	openStore := func(open func(string) (*Store, error)) (*Store, error) {
+		if storeFlag == "" {
+			return nil, &ExitError{Code: ExitConfigError, Message: "error: snapshot store directory is required. Use --store or set the MM_STORE environment variable."}
+		}
+		return open(storeFlag)
+	}
+
+	var storeInitDedup bool
+
+	storeInitCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create a snapshot store",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if storeFlag == "" {
+				return &ExitError{Code: ExitConfigError, Message: "error: snapshot store directory is required. Use --store or set the MM_STORE environment variable."}
+			}
+			store, err := InitStore(storeFlag, storeInitDedup)
+			if err != nil {
+				return err
+			}
+			mode := "plain"
+			if store.Dedup() {
+				mode = "deduplicating"
+			}
+			fmt.Fprintf(os.Stderr, "Initialised %s snapshot store in %s\n", mode, store.Dir())
+			return nil
+		},
+	}
+
+	storeInitCmd.Flags().BoolVar(&storeInitDedup, "dedup", false, "Store identical configurations only once (content-addressed)")
+
+	storeAddCmd := &cobra.Command{
+		Use:   "add <snapshot-file>...",
+		Short: "Import snapshot files into the store",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore(CreateStore)
+			if err != nil {
+				return err
+			}
+			for _, path := range args {
+				snapshot, _, err := LoadSnapshot(path)
+				if err != nil {
+					return err
+				}
+				entry, err := store.Add(snapshot)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s\t%s\n", entry.ID, path)
+			}
+			return nil
+		},
+	}
+
+	storeListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the snapshots in the store",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore(OpenStore)
+			if err != nil {
+				return err
+			}
+			return WriteOutput(FormatStoreList(store.Entries()), "")
+		},
+	}
+
+	storeShowCmd := &cobra.Command{
+		Use:   "show <ref>",
+		Short: "Show details of a stored snapshot (latest, latest~N, ID or date)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore(OpenStore)
+			if err != nil {
+				return err
+			}
+			entry, err := store.Resolve(args[0])
+			if err != nil {
+				return err
+			}
+			config, _, err := store.Load(*entry)
+			if err != nil {
+				return err
+			}
+			return WriteOutput(FormatStoreEntry(*entry, store.Path(*entry), config), "")
+		},
+	}
+
+	storeChangedSinceCmd := &cobra.Command{
+		Use:   "changed-since <ref>",
+		Short: "Report whether the configuration has changed since a stored snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore(OpenStore)
+			if err != nil {
+				return err
+			}
+			unchanged, since, changedAt, err := store.UnchangedSince(args[0])
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				fmt.Printf("No configuration change since %s.\n", since.ID)
+				return nil
+			}
+			fmt.Printf("Configuration changed since %s (first change in %s).\n", since.ID, changedAt.ID)
+			return &ExitError{Code: ExitDriftFound, Message: ""}
+		},
+	}
+
+	var (
+		pruneKeepLast    int
+		pruneKeepDaily   int
+		pruneKeepMonthly int
+		pruneDryRun      bool
+	)
+
+	storePruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove snapshots according to a retention policy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore(OpenStore)
+			if err != nil {
+				return err
+			}
+			total := len(store.Entries())
+			policy := RetentionPolicy{
+				KeepLast:    pruneKeepLast,
+				KeepDaily:   pruneKeepDaily,
+				KeepMonthly: pruneKeepMonthly,
+			}
+			removed, err := store.Prune(policy, time.Now(), pruneDryRun)
+			if err != nil {
+				return err
+			}
+			verb := "removed"
+			if pruneDryRun {
+				verb = "would remove"
+			}
+			for _, e := range removed {
+				fmt.Printf("%s %s\n", verb, e.ID)
+			}
+			fmt.Fprintf(os.Stderr, "%d snapshot(s) %s, %d kept.\n", len(removed), verb, total-len(removed))
+			return nil
+		},
+	}
+
+	storePruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "Keep the N most recent snapshots")
+	storePruneCmd.Flags().IntVar(&pruneKeepDaily, "keep-daily", 0, "Keep the newest snapshot of each day for the last N days")
+	storePruneCmd.Flags().IntVar(&pruneKeepMonthly, "keep-monthly", 0, "Keep the newest snapshot of each month for the last N months")
+	storePruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Show what would be removed without deleting anything")
+
+	storeCmd.AddCommand(storeInitCmd, storeAddCmd, storeListCmd, storeShowCmd, storeChangedSinceCmd, storePruneCmd)
+	rootCmd.AddCommand(storeCmd)
+
+	// Cancel in-flight requests on Ctrl-C or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Execute the root command.
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		if exitErr, ok := err.(*ExitError); ok {
 			if exitErr.Message != "" {
 				fmt.Fprintln(os.Stderr, exitErr.Message)
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// markdownInlineLimit is the longest value shown inline in a table cell;
+// longer values and arrays of several items are folded into <details>.
+const markdownInlineLimit = 80
+
+// FormatDiffMarkdown produces a GitHub-flavoured Markdown report for a diff
+// result, for pasting into change tickets and merge requests.
+func FormatDiffMarkdown(result *DiffResult) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Configuration drift report\n\n")
+	sb.WriteString("| | Source | Server | Captured |\n")
+	sb.WriteString("|---|---|---|---|\n")
+	for _, side := range []struct {
+		label string
+		src   DiffSource
+	}{{"Baseline", result.Baseline}, {"Compared", result.Compared}} {
+		sb.WriteString(fmt.Sprintf("| **%s** | %s | %s | %s |\n", side.label,
+			markdownText(markdownSource(side.src)), markdownText(side.src.ServerURL), markdownText(formatTimestamp(side.src.CapturedAt))))
+	}
+	sb.WriteString("\n")
+
+	if !result.DriftDetected {
+		sb.WriteString("No configuration drift detected.\n")
+		if len(result.NotVisible) > 0 {
+			sb.WriteString(fmt.Sprintf("\n%d field(s) were not compared because one capture could not read them.\n", len(result.NotVisible)))
+		}
+		return sb.String()
+	}
+
+	sb.WriteString("## Summary\n\n")
+	sb.WriteString("| Change | Count |\n")
+	sb.WriteString("|---|---:|\n")
+	sb.WriteString(fmt.Sprintf("| Changed | %d |\n", len(result.Changed)))
+	sb.WriteString(fmt.Sprintf("| Added | %d |\n", len(result.Added)))
+	sb.WriteString(fmt.Sprintf("| Removed | %d |\n", len(result.Removed)))
+	if len(result.NotVisible) > 0 {
+		sb.WriteString(fmt.Sprintf("| Not visible | %d |\n", len(result.NotVisible)))
+	}
+	sb.WriteString(fmt.Sprintf("| **Total** | **%d** |\n", len(result.Changed)+len(result.Added)+len(result.Removed)))
+
+	for _, group := range GroupBySection(result.Entries()) {
+		sb.WriteString(fmt.Sprintf("\n## %s\n\n", markdownText(group.Section)))
+		sb.WriteString("| Setting | Change | Before | After |\n")
+		sb.WriteString("|---|---|---|---|\n")
+		for _, e := range group.Entries {
+			before, after := "", ""
+			if e.ChangeType != "added" {
+				before = markdownValue(e.Before)
+			}
+			if e.ChangeType != "removed" {
+				after = markdownValue(e.After)
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				markdownCode(strings.TrimPrefix(e.Field, group.Section+".")), e.ChangeType, before, after))
+		}
+	}
+
+	if len(result.NotVisible) > 0 {
+		sb.WriteString("\n## Not visible\n\n")
+		sb.WriteString("These settings were not compared because one capture could not read them.\n\n")
+		sb.WriteString("| Setting | Not readable in | Value |\n")
+		sb.WriteString("|---|---|---|\n")
+		for _, n := range result.NotVisible {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", markdownCode(n.Field), n.HiddenIn, markdownValue(n.Value)))
+		}
+	}
+
+	return sb.String()
+}
+
+// markdownSource describes a diff source without its server and time,
+// which have their own columns.
+func markdownSource(src DiffSource) string {
+	switch {
+	case src.File != "":
+		return src.File
+	case src.Source != "":
+		return src.Source
+	case src.ServerURL != "":
+		return "live"
+	}
+	return "unknown"
+}
+
+// markdownValue renders a value for a table cell. Arrays of more than a
+// few items and long values are folded into a <details> element.
+func markdownValue(v interface{}) string {
+	formatted := FormatValue(v)
+	items, isArray := v.([]interface{})
+	if (!isArray || len(items) <= 3) && len(formatted) <= markdownInlineLimit {
+		return markdownCode(formatted)
+	}
+
+	summary := fmt.Sprintf("%d characters", len(formatted))
+	var body string
+	if isArray {
+		summary = fmt.Sprintf("%d items", len(items))
+		lines := make([]string, len(items))
+		for i, item := range items {
+			lines[i] = "<code>" + markdownHTML(FormatValue(item)) + "</code>"
+		}
+		body = strings.Join(lines, "<br>")
+	} else {
+		body = "<code>" + markdownHTML(formatted) + "</code>"
+	}
+	return "<details><summary>" + summary + "</summary>" + body + "</details>"
+}
+
+// markdownCode renders s as an inline code span safe inside a table.
+func markdownCode(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// markdownHTML escapes s for HTML inside a table cell.
+func markdownHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "|", "&#124;")
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// markdownText escapes characters with meaning in Markdown tables.
+func markdownText(s string) string {
+	if s == "" {
+		return "—"
+	}
+	r := strings.NewReplacer("|", `\|`, "\n", " ", "<", "&lt;", ">", "&gt;")
+	return r.Replace(s)
+}
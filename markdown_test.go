@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func sampleDiffResult() *DiffResult {
+	return &DiffResult{
+		Baseline:      DiffSource{File: "baseline.json", Source: "file", ServerURL: "https://mm.example.com", CapturedAt: "2025-10-01T09:00:00Z"},
+		Compared:      DiffSource{Source: "live", ServerURL: "https://mm.example.com", CapturedAt: "now"},
+		DriftDetected: true,
+		Changed: []ChangedField{
+			{Field: "ServiceSettings.MaximumLoginAttempts", Before: float64(10), After: float64(5)},
+			{Field: "ServiceSettings.AllowCorsFrom", Before: "", After: "a|b"},
+		},
+		Added: []AddedField{
+			{Field: "PluginSettings.PluginStates", Value: []interface{}{"com.a", "com.b", "com.c", "com.d"}},
+		},
+		Removed: []RemovedField{
+			{Field: "TeamSettings.ExperimentalDefaultChannels", Value: []interface{}{"town-square"}},
+		},
+	}
+}
+
+func TestFormatDiffMarkdown(t *testing.T) {
+	out := FormatDiffMarkdown(sampleDiffResult())
+
+	for _, want := range []string{
+		"# Configuration drift report",
+		"| **Baseline** | baseline.json | https://mm.example.com | 2025-10-01T09:00:00Z |",
+		"| **Compared** | live | https://mm.example.com | now |",
+		"| Changed | 2 |",
+		"| **Total** | **4** |",
+		"## ServiceSettings",
+		"| `MaximumLoginAttempts` | changed | `10` | `5` |",
+		// Pipes in values must not split the table cell.
+		"| `AllowCorsFrom` | changed | `\"\"` | `\"a\\|b\"` |",
+		"| `ExperimentalDefaultChannels` | removed | `[\"town-square\"]` |  |",
+		"<details><summary>4 items</summary><code>&#34;com.a&#34;</code><br>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Sections appear in order, each once.
+	plugin := strings.Index(out, "## PluginSettings")
+	service := strings.Index(out, "## ServiceSettings")
+	team := strings.Index(out, "## TeamSettings")
+	if plugin < 0 || !(plugin < service && service < team) || strings.Count(out, "## ServiceSettings") != 1 {
+		t.Errorf("sections out of order:\n%s", out)
+	}
+}
+
+func TestFormatDiffMarkdown_NoDrift(t *testing.T) {
+	out := FormatDiffMarkdown(&DiffResult{})
+	if !strings.Contains(out, "No configuration drift detected.") || strings.Contains(out, "## Summary") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestMarkdownCode(t *testing.T) {
+	tests := map[string]string{
+		"plain":     "`plain`",
+		"a`b":       "``a`b``",
+		"`edge":     "`` `edge ``",
+		"pipe|char": "`pipe\\|char`",
+	}
+	for in, want := range tests {
+		if got := markdownCode(in); got != want {
+			t.Errorf("markdownCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
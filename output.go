@@ -10,57 +10,88 @@ import (
 
 // FormatDiffText produces human-readable text output for a diff result.
 func FormatDiffText(result *DiffResult) string {
+	return FormatDiffTextWith(result, TextOptions{})
+}
+
+// FormatDiffTextWith produces text output for a diff result, optionally
+// coloured and with before and after values side by side.
+func FormatDiffTextWith(result *DiffResult, opts TextOptions) string {
 	var sb strings.Builder
+	p := painter{color: opts.Color}
 
 	if !result.DriftDetected {
-		sb.WriteString("No configuration drift detected.\n")
+		sb.WriteString(p.paint(ansiGreen, "No configuration drift detected.") + "\n")
+		if len(result.NotVisible) > 0 {
+			sb.WriteString(fmt.Sprintf("%d field(s) were not compared because one capture could not read them.\n", len(result.NotVisible)))
+		}
 		return sb.String()
 	}
 
-	sb.WriteString("Configuration drift detected between:\n")
+	sb.WriteString(p.paint(ansiBold, "Configuration drift detected between:") + "\n")
 	sb.WriteString(fmt.Sprintf("  Baseline : %s", formatSource(result.Baseline)))
 	sb.WriteString("\n")
 	sb.WriteString(fmt.Sprintf("  Compared : %s", formatSource(result.Compared)))
 	sb.WriteString("\n\n")
 
+	if opts.SideBySide {
+		writeSideBySide(&sb, result, p, opts.Width)
+		writeNotVisible(&sb, result, p)
+		return sb.String()
+	}
+
 	// Changed
-	sb.WriteString(fmt.Sprintf("CHANGED (%d):\n", len(result.Changed)))
+	sb.WriteString(p.paint(ansiBold+ansiYellow, fmt.Sprintf("CHANGED (%d):", len(result.Changed))) + "\n")
 	if len(result.Changed) == 0 {
 		sb.WriteString("  (none)\n")
 	} else {
 		for _, c := range result.Changed {
-			sb.WriteString(fmt.Sprintf("  %s\n", c.Field))
-			sb.WriteString(fmt.Sprintf("    Before : %s\n", FormatValue(c.Before)))
-			sb.WriteString(fmt.Sprintf("    After  : %s\n", FormatValue(c.After)))
+			before, after := FormatValue(c.Before), FormatValue(c.After)
+			if p.color {
+				left, right := changedValueSpans(c.Before, c.After)
+				before, after = p.spans(left), p.spans(right)
+			}
+			sb.WriteString(fmt.Sprintf("  %s\n", p.paint(ansiYellow, c.Field)))
+			sb.WriteString(fmt.Sprintf("    Before : %s\n", before))
+			sb.WriteString(fmt.Sprintf("    After  : %s\n", after))
 			sb.WriteString("\n")
 		}
 	}
 
 	// Added
-	sb.WriteString(fmt.Sprintf("ADDED (%d):\n", len(result.Added)))
+	sb.WriteString(p.paint(ansiBold+ansiGreen, fmt.Sprintf("ADDED (%d):", len(result.Added))) + "\n")
 	if len(result.Added) == 0 {
 		sb.WriteString("  (none)\n")
 	} else {
 		for _, a := range result.Added {
-			sb.WriteString(fmt.Sprintf("  %s : %s\n", a.Field, FormatValue(a.Value)))
+			sb.WriteString(fmt.Sprintf("  %s : %s\n", p.paint(ansiGreen, a.Field), p.paint(ansiGreen, FormatValue(a.Value))))
 		}
 	}
 
 	sb.WriteString("\n")
 
 	// Removed
-	sb.WriteString(fmt.Sprintf("REMOVED (%d):\n", len(result.Removed)))
+	sb.WriteString(p.paint(ansiBold+ansiRed, fmt.Sprintf("REMOVED (%d):", len(result.Removed))) + "\n")
 	if len(result.Removed) == 0 {
 		sb.WriteString("  (none)\n")
 	} else {
 		for _, r := range result.Removed {
-			sb.WriteString(fmt.Sprintf("  %s : %s\n", r.Field, FormatValue(r.Value)))
+			sb.WriteString(fmt.Sprintf("  %s : %s\n", p.paint(ansiRed, r.Field), p.paint(ansiRed, FormatValue(r.Value))))
 		}
 	}
 
+	writeNotVisible(&sb, result, p)
 	return sb.String()
 }
 
+func writeNotVisible(sb *strings.Builder, result *DiffResult, p painter) {
+	if len(result.NotVisible) > 0 {
+		sb.WriteString(p.paint(ansiBold+ansiDim, fmt.Sprintf("\nNOT VISIBLE (%d):", len(result.NotVisible))) + "\n")
+		for _, n := range result.NotVisible {
+			sb.WriteString(fmt.Sprintf("  %s : %s (not readable in %s)\n", n.Field, FormatValue(n.Value), n.HiddenIn))
+		}
+	}
+}
+
 // FormatDiffJSON produces JSON output for a diff result.
 func FormatDiffJSON(result *DiffResult) (string, error) {
 	data, err := json.MarshalIndent(result, "", "  ")
@@ -141,3 +172,153 @@ func formatTimestamp(iso string) string {
 	// Keep it simple: return as-is since it's already ISO 8601
 	return iso
 }
+
+// FormatStoreList produces a table of store entries, newest first, with the
+// latest~N reference that selects each one.
+func FormatStoreList(entries []StoreEntry) string {
+	if len(entries) == 0 {
+		return "The snapshot store is empty.\n"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-10s  %-24s  %-22s  %s\n", "REF", "ID", "CAPTURED", "SERVER"))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		ref := "latest"
+		if offset := len(entries) - 1 - i; offset > 0 {
+			ref = fmt.Sprintf("latest~%d", offset)
+		}
+		sb.WriteString(fmt.Sprintf("%-10s  %-24s  %-22s  %s\n", ref, e.ID, formatTimestamp(e.CapturedAt), e.ServerURL))
+	}
+	return sb.String()
+}
+
+// FormatStoreEntry describes a single stored snapshot.
+func FormatStoreEntry(entry StoreEntry, path string, config map[string]interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("ID           : %s\n", entry.ID))
+	sb.WriteString(fmt.Sprintf("Captured     : %s\n", formatTimestamp(entry.CapturedAt)))
+	sb.WriteString(fmt.Sprintf("Server       : %s\n", entry.ServerURL))
+	sb.WriteString(fmt.Sprintf("Tool version : %s\n", entry.ToolVersion))
+	sb.WriteString(fmt.Sprintf("File         : %s\n", path))
+	if entry.ContentHash != "" {
+		sb.WriteString(fmt.Sprintf("Content hash : %s\n", entry.ContentHash))
+	}
+	sb.WriteString(fmt.Sprintf("Settings     : %d fields in %d sections\n",
+		len(FlattenConfig(StripMetadata(config), "")), len(StripMetadata(config))))
+	return sb.String()
+}
+
+// FormatHistoryText produces a human-readable listing of recorded changes.
+func FormatHistoryText(changes []HistoryChange) string {
+	if len(changes) == 0 {
+		return "No matching changes recorded.\n"
+	}
+
+	var sb strings.Builder
+	for _, c := range changes {
+		when := formatTimestamp(c.IntervalEnd)
+		if c.IntervalStart != "" {
+			when = fmt.Sprintf("%s .. %s", formatTimestamp(c.IntervalStart), formatTimestamp(c.IntervalEnd))
+		}
+		sb.WriteString(fmt.Sprintf("%s  %s  [%s, %s]\n", when, c.ServerURL, strings.ToUpper(c.ChangeType), c.Severity))
+		switch c.ChangeType {
+		case "changed":
+			sb.WriteString(fmt.Sprintf("  %s\n", c.Field))
+			sb.WriteString(fmt.Sprintf("    Before : %s\n", FormatValue(c.Before)))
+			sb.WriteString(fmt.Sprintf("    After  : %s\n", FormatValue(c.After)))
+		case "added":
+			sb.WriteString(fmt.Sprintf("  %s : %s\n", c.Field, FormatValue(c.After)))
+		default:
+			sb.WriteString(fmt.Sprintf("  %s : %s\n", c.Field, FormatValue(c.Before)))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\n%d change(s).\n", len(changes)))
+	return sb.String()
+}
+
+// FormatProfileList lists the profiles of a tool configuration, marking
+// the active one.
+func FormatProfileList(cfg *ToolConfig, active string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Configuration: %s\n\n", strings.Join(cfg.Files, ", ")))
+	if len(cfg.Profiles) == 0 {
+		sb.WriteString("No profiles defined.\n")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("  %-16s  %-8s  %s\n", "PROFILE", "AUTH", "SERVER"))
+	for _, name := range cfg.ProfileNames() {
+		p := cfg.Profiles[name]
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		auth := p.Auth
+		if auth == "" {
+			auth = "-"
+		}
+		server := p.URL
+		if p.Auth == AuthLocal {
+			server = p.LocalSocket
+			if server == "" {
+				server = DefaultLocalSocket
+			}
+			server = "unix://" + server
+		}
+		sb.WriteString(fmt.Sprintf("%s %-16s  %-8s  %s\n", marker, name, auth, server))
+	}
+	return sb.String()
+}
+
+// FormatClusterText produces human-readable output for a cluster
+// consistency check.
+func FormatClusterText(report *ClusterReport) string {
+	var sb strings.Builder
+
+	if report.ServerURL != "" {
+		sb.WriteString(fmt.Sprintf("Cluster status from %s\n\n", report.ServerURL))
+	}
+	if len(report.Nodes) > 0 {
+		sb.WriteString(fmt.Sprintf("  %-24s  %-15s  %-12s  %s\n", "NODE", "ADDRESS", "VERSION", "CONFIG HASH"))
+		for _, n := range report.Nodes {
+			marker := " "
+			if n.ConfigHashMismatch || n.VersionMismatch {
+				marker = "!"
+			}
+			sb.WriteString(fmt.Sprintf("%s %-24s  %-15s  %-12s  %s\n", marker, n.Hostname, n.IPAddress, n.Version, n.ConfigHash))
+		}
+		sb.WriteString("\n")
+		for _, n := range report.Nodes {
+			if n.ConfigHashMismatch {
+				sb.WriteString(fmt.Sprintf("Node %s has config hash %s; most nodes have %s.\n", n.Hostname, n.ConfigHash, report.ConfigHash))
+			}
+			if n.VersionMismatch {
+				sb.WriteString(fmt.Sprintf("Node %s runs version %s; most nodes run %s.\n", n.Hostname, n.Version, report.Version))
+			}
+		}
+	} else if report.ServerURL != "" {
+		sb.WriteString("The server reported no cluster nodes. Is clustering enabled?\n")
+	}
+
+	for _, c := range report.Comparisons {
+		sb.WriteString("\n")
+		switch {
+		case c.Error != "":
+			sb.WriteString(fmt.Sprintf("Node %s: unable to read configuration: %s\n", c.Node, c.Error))
+		case !c.Diff.DriftDetected:
+			sb.WriteString(fmt.Sprintf("Node %s: configuration matches %s.\n", c.Node, c.Reference))
+		default:
+			sb.WriteString(fmt.Sprintf("Node %s: configuration differs from %s.\n", c.Node, c.Reference))
+			sb.WriteString(FormatDiffText(c.Diff))
+		}
+	}
+
+	sb.WriteString("\n")
+	if report.Consistent {
+		sb.WriteString("Cluster configuration is consistent.\n")
+	} else {
+		sb.WriteString("Cluster configuration is INCONSISTENT.\n")
+	}
+	return sb.String()
+}
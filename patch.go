@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// PatchOp is one RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	Op    string
+	Path  string
+	Value interface{} // unused for "remove"
+
+	keys []string // path as config keys
+}
+
+// MarshalJSON writes the value of every operation but "remove", including
+// null, false and zero values.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	doc := map[string]interface{}{"op": op.Op, "path": op.Path}
+	if op.Op != "remove" {
+		doc["value"] = op.Value
+	}
+	return json.Marshal(doc)
+}
+
+// DiffPatch returns the JSON Patch operations that turn the baseline
+// config into the compared one, both without _metadata. Dot-notation
+// fields are split into keys by looking them up in the configs, so keys
+// that themselves contain dots, such as plugin IDs, are kept whole.
+//
+// Removals come first, then replacements, then additions. A section or
+// object that exists on one side only is removed or added as a whole, so
+// that the patched config has no empty objects left behind and no
+// addition targets a missing parent.
+func DiffPatch(result *DiffResult, baseline, target map[string]interface{}) []PatchOp {
+	base := StripMetadata(baseline)
+	tgt := StripMetadata(target)
+	var ops []PatchOp
+
+	removed := make(map[string]bool)
+	for _, r := range result.Removed {
+		keys := outermostMissing(splitField(base, r.Field), tgt)
+		path := JSONPointer(keys)
+		if removed[path] {
+			continue
+		}
+		removed[path] = true
+		ops = append(ops, PatchOp{Op: "remove", Path: path, keys: keys})
+	}
+
+	for _, c := range result.Changed {
+		keys := splitField(base, c.Field)
+		ops = append(ops, PatchOp{Op: "replace", Path: JSONPointer(keys), Value: c.After, keys: keys})
+	}
+
+	// Additions under a missing parent are gathered into one object.
+	added := make(map[string]int)
+	for _, a := range result.Added {
+		leaf := splitField(tgt, a.Field)
+		keys := outermostMissing(leaf, base)
+		path := JSONPointer(keys)
+		if len(keys) == len(leaf) {
+			ops = append(ops, PatchOp{Op: "add", Path: path, Value: a.Value, keys: keys})
+			continue
+		}
+		i, ok := added[path]
+		if !ok {
+			i = len(ops)
+			added[path] = i
+			ops = append(ops, PatchOp{Op: "add", Path: path, Value: map[string]interface{}{}, keys: keys})
+		}
+		setKeys(ops[i].Value.(map[string]interface{}), leaf[len(keys):], a.Value)
+	}
+
+	return ops
+}
+
+// FormatDiffJSONPatch produces an RFC 6902 JSON Patch document that turns
+// the baseline config into the compared one.
+func FormatDiffJSONPatch(result *DiffResult, baseline, target map[string]interface{}) (string, error) {
+	ops := DiffPatch(result, baseline, target)
+	if ops == nil {
+		ops = []PatchOp{}
+	}
+	return marshalPatch(ops)
+}
+
+// FormatDiffMergePatch produces an RFC 7386 JSON Merge Patch document that
+// turns the baseline config into the compared one. A merge patch cannot
+// set a setting to null, as null means removal.
+func FormatDiffMergePatch(result *DiffResult, baseline, target map[string]interface{}) (string, error) {
+	patch := make(map[string]interface{})
+	for _, op := range DiffPatch(result, baseline, target) {
+		var value interface{}
+		if op.Op != "remove" {
+			value = op.Value
+		}
+		setKeys(patch, op.keys, value)
+	}
+	return marshalPatch(patch)
+}
+
+func marshalPatch(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to marshal patch", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// JSONPointer returns the RFC 6901 JSON Pointer for a list of keys.
+func JSONPointer(keys []string) string {
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString("/")
+		sb.WriteString(escape.Replace(k))
+	}
+	return sb.String()
+}
+
+// splitField splits a dot-notation field into the keys it was flattened
+// from in config. Where keys contain dots the split is ambiguous, and the
+// first split that reaches a value in config wins, trying longer keys
+// first. A field not found in config is split at every dot.
+func splitField(config map[string]interface{}, field string) []string {
+	if keys, ok := matchKeys(config, field); ok {
+		return keys
+	}
+	return strings.Split(field, ".")
+}
+
+func matchKeys(m map[string]interface{}, rest string) ([]string, bool) {
+	var candidates []string
+	for k := range m {
+		if rest == k || strings.HasPrefix(rest, k+".") {
+			candidates = append(candidates, k)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return len(candidates[i]) > len(candidates[j]) })
+
+	for _, k := range candidates {
+		if rest == k {
+			return []string{k}, true
+		}
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if keys, ok := matchKeys(child, rest[len(k)+1:]); ok {
+			return append([]string{k}, keys...), true
+		}
+	}
+	return nil, false
+}
+
+// outermostMissing returns the shortest prefix of keys that is not an
+// object in config, which is keys itself when all its parents are.
+func outermostMissing(keys []string, config map[string]interface{}) []string {
+	m := config
+	for i, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			return keys[:i+1]
+		}
+		m = child
+	}
+	return keys
+}
+
+// setKeys sets the value at keys in m, creating or replacing parents that
+// are not objects.
+func setKeys(m map[string]interface{}, keys []string, value interface{}) {
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			m[k] = child
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = value
+}
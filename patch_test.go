@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func patchConfigs() (baseline, target map[string]interface{}) {
+	baseline = map[string]interface{}{
+		"_metadata": map[string]interface{}{"server_url": "https://mm.example.com"},
+		"ServiceSettings": map[string]interface{}{
+			"SiteURL":              "https://mm.example.com",
+			"MaximumLoginAttempts": float64(10),
+			"EnableDeveloper":      true,
+		},
+		"PluginSettings": map[string]interface{}{
+			"Plugins": map[string]interface{}{
+				"com.mattermost.calls": map[string]interface{}{"udpserverport": float64(8443)},
+				"playbooks":            map[string]interface{}{"enabled": true},
+			},
+		},
+		"FileSettings": map[string]interface{}{
+			"Directory": "./data/",
+			"Paths":     map[string]interface{}{"tmp/dir": "/tmp", "a~b": "x"},
+		},
+		"ExperimentalSettings": map[string]interface{}{"ClientSideCertEnable": false},
+	}
+	target = map[string]interface{}{
+		"_metadata": map[string]interface{}{"server_url": "https://mm.example.com"},
+		"ServiceSettings": map[string]interface{}{
+			"SiteURL":              "https://mm.example.com",
+			"MaximumLoginAttempts": float64(5),
+			"EnableDeveloper":      false,
+			"AllowCorsFrom":        "",
+		},
+		"PluginSettings": map[string]interface{}{
+			"Plugins": map[string]interface{}{
+				"com.mattermost.calls": map[string]interface{}{"udpserverport": float64(8444)},
+				"com.mattermost.ai":    map[string]interface{}{"enabled": true, "model": "x"},
+			},
+		},
+		"FileSettings": map[string]interface{}{
+			"Directory": "./data/",
+			"Paths":     map[string]interface{}{"tmp/dir": "/var/tmp", "a~b": "x"},
+		},
+		"MetricsSettings": map[string]interface{}{"Enable": true},
+	}
+	return baseline, target
+}
+
+func TestFormatDiffJSONPatch(t *testing.T) {
+	baseline, target := patchConfigs()
+	result := CompareConfigs(baseline, target, nil)
+
+	out, err := FormatDiffJSONPatch(result, baseline, target)
+	if err != nil {
+		t.Fatalf("FormatDiffJSONPatch() error: %v", err)
+	}
+	var ops []map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &ops); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+
+	for _, want := range []string{
+		`"path": "/PluginSettings/Plugins/com.mattermost.calls/udpserverport"`,
+		`"path": "/FileSettings/Paths/tmp~1dir"`,
+		// Whole objects on one side only.
+		`"path": "/ExperimentalSettings"`,
+		`"path": "/PluginSettings/Plugins/playbooks"`,
+		`"path": "/PluginSettings/Plugins/com.mattermost.ai"`,
+		// False and empty values are written.
+		`"value": false`,
+		`"value": ""`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("patch missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "_metadata") {
+		t.Errorf("patch should not touch _metadata:\n%s", out)
+	}
+
+	patched := applyJSONPatch(t, StripMetadata(deepCopy(baseline)), ops)
+	if !reflect.DeepEqual(patched, StripMetadata(target)) {
+		t.Errorf("patched baseline differs from target:\n got %v\nwant %v", patched, StripMetadata(target))
+	}
+}
+
+func TestFormatDiffJSONPatchNoDrift(t *testing.T) {
+	baseline, _ := patchConfigs()
+	out, err := FormatDiffJSONPatch(CompareConfigs(baseline, baseline, nil), baseline, baseline)
+	if err != nil {
+		t.Fatalf("FormatDiffJSONPatch() error: %v", err)
+	}
+	if out != "[]\n" {
+		t.Errorf("output = %q, want []", out)
+	}
+}
+
+func TestFormatDiffMergePatch(t *testing.T) {
+	baseline, target := patchConfigs()
+	result := CompareConfigs(baseline, target, nil)
+
+	out, err := FormatDiffMergePatch(result, baseline, target)
+	if err != nil {
+		t.Fatalf("FormatDiffMergePatch() error: %v", err)
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &patch); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if v, ok := patch["ExperimentalSettings"]; !ok || v != nil {
+		t.Errorf("removed section should be null: %v", v)
+	}
+
+	patched := applyMergePatch(StripMetadata(deepCopy(baseline)), patch)
+	if !reflect.DeepEqual(patched, StripMetadata(target)) {
+		t.Errorf("patched baseline differs from target:\n got %v\nwant %v", patched, StripMetadata(target))
+	}
+}
+
+func TestDiffPatchTypeChange(t *testing.T) {
+	baseline := map[string]interface{}{"A": map[string]interface{}{"B": map[string]interface{}{"C": float64(1)}, "D": "x"}}
+	target := map[string]interface{}{"A": map[string]interface{}{"B": "flat", "D": map[string]interface{}{"E": true}}}
+	result := CompareConfigs(baseline, target, nil)
+
+	out, _ := FormatDiffJSONPatch(result, baseline, target)
+	var ops []map[string]interface{}
+	json.Unmarshal([]byte(out), &ops)
+	if patched := applyJSONPatch(t, deepCopy(baseline), ops); !reflect.DeepEqual(patched, target) {
+		t.Errorf("JSON patch: got %v, want %v\n%s", patched, target, out)
+	}
+
+	out, _ = FormatDiffMergePatch(result, baseline, target)
+	var patch map[string]interface{}
+	json.Unmarshal([]byte(out), &patch)
+	if patched := applyMergePatch(deepCopy(baseline), patch); !reflect.DeepEqual(patched, target) {
+		t.Errorf("merge patch: got %v, want %v\n%s", patched, target, out)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"ServiceSettings", "SiteURL"}, "/ServiceSettings/SiteURL"},
+		{[]string{"Plugins", "com.mattermost.calls"}, "/Plugins/com.mattermost.calls"},
+		{[]string{"a/b", "c~d"}, "/a~1b/c~0d"},
+		{[]string{"~1"}, "/~01"},
+	}
+	for _, tt := range tests {
+		if got := JSONPointer(tt.keys); got != tt.want {
+			t.Errorf("JSONPointer(%q) = %q, want %q", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestSplitField(t *testing.T) {
+	config := map[string]interface{}{
+		"PluginSettings": map[string]interface{}{
+			"Plugins": map[string]interface{}{
+				"com.mattermost.calls": map[string]interface{}{"a.b": float64(1)},
+				"com":                  map[string]interface{}{"other": float64(2)},
+			},
+		},
+	}
+	tests := []struct {
+		field string
+		want  []string
+	}{
+		{"PluginSettings.Plugins.com.mattermost.calls.a.b", []string{"PluginSettings", "Plugins", "com.mattermost.calls", "a.b"}},
+		{"PluginSettings.Plugins.com.other", []string{"PluginSettings", "Plugins", "com", "other"}},
+		{"Missing.Field", []string{"Missing", "Field"}},
+	}
+	for _, tt := range tests {
+		if got := splitField(config, tt.field); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitField(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+// applyJSONPatch applies the object operations of an RFC 6902 patch.
+func applyJSONPatch(t *testing.T, doc map[string]interface{}, ops []map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for _, op := range ops {
+		parts := strings.Split(op["path"].(string), "/")[1:]
+		parent := doc
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := parent[unescape.Replace(p)].(map[string]interface{})
+			if !ok {
+				t.Fatalf("%s %s: parent does not exist", op["op"], op["path"])
+			}
+			parent = child
+		}
+		key := unescape.Replace(parts[len(parts)-1])
+		_, exists := parent[key]
+		switch op["op"] {
+		case "remove", "replace":
+			if !exists {
+				t.Fatalf("%s %s: target does not exist", op["op"], op["path"])
+			}
+		}
+		if op["op"] == "remove" {
+			delete(parent, key)
+			continue
+		}
+		parent[key] = op["value"]
+	}
+	return doc
+}
+
+// applyMergePatch applies an RFC 7386 merge patch.
+func applyMergePatch(target interface{}, patch interface{}) map[string]interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	doc, ok := target.(map[string]interface{})
+	if !ok {
+		doc = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(doc, k)
+			continue
+		}
+		if _, isObject := v.(map[string]interface{}); isObject {
+			doc[k] = applyMergePatch(doc[k], v)
+			continue
+		}
+		doc[k] = v
+	}
+	return doc
+}
+
+func deepCopy(m map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(m)
+	var result map[string]interface{}
+	json.Unmarshal(data, &result)
+	return result
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFile is the per-project tool configuration file, looked up
+// in the working directory and its parents.
+const ProjectConfigFile = ".mm-config-diff.yaml"
+
+// Authentication methods a profile can select.
+const (
+	AuthToken    = "token"
+	AuthPassword = "password"
+	AuthLocal    = "local"
+)
+
+// ToolConfig is the tool configuration file: a set of named connection
+// profiles.
+type ToolConfig struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+
+	// Files lists the files the configuration was read from.
+	Files []string `yaml:"-"`
+}
+
+// Profile holds the connection settings and defaults for one server.
+// Settings given as flags or environment variables take precedence.
+type Profile struct {
+	URL                string            `yaml:"url"`
+	Auth               string            `yaml:"auth"` // token, password or local
+	Username           string            `yaml:"username"`
+	TokenFile          string            `yaml:"token_file"`
+	PasswordFile       string            `yaml:"password_file"`
+	CredentialHelper   string            `yaml:"credential_helper"`
+	LocalSocket        string            `yaml:"local_socket"`
+	CACert             string            `yaml:"ca_cert"`
+	ClientCert         string            `yaml:"client_cert"`
+	ClientKey          string            `yaml:"client_key"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+	Proxy              string            `yaml:"proxy"`
+	Headers            map[string]string `yaml:"headers"`
+	Timeout            *time.Duration    `yaml:"timeout"`
+	Retries            *int              `yaml:"retries"`
+	IgnoreFields       []string          `yaml:"ignore_fields"`
+	Format             string            `yaml:"format"`
+}
+
+// UserConfigPath returns the path of the user's tool configuration file,
+// ~/.config/mm-config-diff/config.yaml on Linux.
+func UserConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mm-config-diff", "config.yaml")
+}
+
+// LoadToolConfig reads the tool configuration. An explicit path is read on
+// its own and must exist. Otherwise the user's file is read, and profiles
+// in the nearest project file beneath workDir replace those of the same
+// name. Missing files are not an error.
+func LoadToolConfig(explicitPath, workDir string) (*ToolConfig, error) {
+	cfg := &ToolConfig{Profiles: map[string]*Profile{}}
+
+	if explicitPath != "" {
+		if err := cfg.merge(explicitPath, true); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: tool configuration file %s not found", explicitPath), err)
+			}
+			return nil, err
+		}
+		return cfg, nil
+	}
+
+	if path := UserConfigPath(); path != "" {
+		if err := cfg.merge(path, true); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	// A project file comes with whatever checkout the tool runs in, so it
+	// may not set where credentials are sent or how they are obtained.
+	if project := findProjectConfig(workDir); project != "" {
+		if err := cfg.merge(project, false); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// merge reads the file at path over the configuration. Unless the file is
+// trusted, its profiles may not set the keys listed by untrustedKeys.
+func (c *ToolConfig) merge(path string, trusted bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file ToolConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && err != io.EOF {
+		return NewExitError(ExitConfigError, fmt.Sprintf("error: tool configuration file %s is invalid", path), err)
+	}
+
+	dir := filepath.Dir(path)
+	for name, p := range file.Profiles {
+		if p == nil {
+			p = &Profile{}
+		}
+		if err := p.validate(); err != nil {
+			return NewExitError(ExitConfigError, fmt.Sprintf("error: profile %q in %s: %s", name, path, err), nil)
+		}
+		if keys := p.untrustedKeys(); !trusted && len(keys) > 0 {
+			return NewExitError(ExitConfigError, fmt.Sprintf("error: profile %q in project file %s sets %s, which only the user configuration file (%s) or --tool-config may set.", name, path, strings.Join(keys, ", "), UserConfigPath()), nil)
+		}
+		p.resolvePaths(dir)
+		c.Profiles[name] = p
+	}
+	if file.DefaultProfile != "" {
+		c.DefaultProfile = file.DefaultProfile
+	}
+	c.Files = append(c.Files, path)
+	return nil
+}
+
+// Profile returns the named profile, or the default profile if name is
+// empty. It returns nil if no profile is selected.
+func (c *ToolConfig) Profile(name string) (*Profile, string, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return nil, "", nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		msg := fmt.Sprintf("error: profile %q not found", name)
+		if len(c.Files) == 0 {
+			msg += fmt.Sprintf(". No tool configuration file was found; create %s or %s.", UserConfigPath(), ProjectConfigFile)
+		} else {
+			msg += fmt.Sprintf(" in %s. Available profiles: %s", strings.Join(c.Files, ", "), strings.Join(c.ProfileNames(), ", "))
+		}
+		return nil, "", NewExitError(ExitConfigError, msg, nil)
+	}
+	return p, name, nil
+}
+
+// ProfileNames returns the profile names in sorted order.
+func (c *ToolConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Profile) validate() error {
+	switch p.Auth {
+	case "", AuthToken, AuthPassword, AuthLocal:
+	default:
+		return fmt.Errorf("unknown auth method %q. Use token, password or local", p.Auth)
+	}
+	if p.Auth == AuthPassword && p.Username == "" {
+		return fmt.Errorf("auth: password requires a username")
+	}
+	return nil
+}
+
+// ProfileEnv names the environment variables that may override a
+// profile's connection target and credentials. An empty name means the
+// variable is ignored.
+type ProfileEnv struct {
+	URL, LocalSocket, ConfigDSN string
+	Token, TokenFile            string
+}
+
+// Env returns the environment variables that may override the profile.
+// The auth method rules out credentials of the other methods. A profile
+// named explicitly also rules out a target or token exported for another
+// server whenever it sets its own.
+func (p *Profile) Env(explicit bool) ProfileEnv {
+	env := ProfileEnv{URL: "MM_URL", LocalSocket: "MM_LOCAL_SOCKET", ConfigDSN: "MM_CONFIG_DSN", Token: "MM_TOKEN", TokenFile: "MM_TOKEN_FILE"}
+	switch p.Auth {
+	case AuthPassword:
+		env.Token, env.TokenFile = "", ""
+	case AuthLocal:
+		env.URL = ""
+	}
+	if !explicit {
+		return env
+	}
+	if p.URL != "" || p.Auth == AuthLocal {
+		env.ConfigDSN = ""
+	}
+	if p.URL != "" {
+		env.LocalSocket = ""
+	}
+	if p.TokenFile != "" || p.PasswordFile != "" || p.CredentialHelper != "" {
+		env.Token, env.TokenFile = "", ""
+	}
+	return env
+}
+
+// untrustedKeys returns the keys set in the profile that could run a
+// command or send credentials to another server.
+func (p *Profile) untrustedKeys() []string {
+	var keys []string
+	if p.URL != "" {
+		keys = append(keys, "url")
+	}
+	if p.CredentialHelper != "" {
+		keys = append(keys, "credential_helper")
+	}
+	if len(p.Headers) > 0 {
+		keys = append(keys, "headers")
+	}
+	if p.InsecureSkipVerify {
+		keys = append(keys, "insecure_skip_verify")
+	}
+	if p.Proxy != "" {
+		keys = append(keys, "proxy")
+	}
+	return keys
+}
+
+// resolvePaths expands ~ and makes file paths relative to the
+// configuration file's directory, so that project files can refer to
+// certificates beside them.
+func (p *Profile) resolvePaths(dir string) {
+	home, _ := os.UserHomeDir()
+	for _, path := range []*string{&p.CACert, &p.ClientCert, &p.ClientKey, &p.LocalSocket, &p.TokenFile, &p.PasswordFile} {
+		switch {
+		case *path == "" || filepath.IsAbs(*path):
+		case strings.HasPrefix(*path, "~/") && home != "":
+			*path = filepath.Join(home, (*path)[2:])
+		default:
+			*path = filepath.Join(dir, *path)
+		}
+	}
+}
+
+// findProjectConfig returns the nearest project configuration file in dir
+// or its parents.
+func findProjectConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
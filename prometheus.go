@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PrometheusContentType is the media type of the Prometheus text format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// FormatDiffPrometheus produces metrics in the Prometheus text format for
+// the node_exporter textfile collector. Every metric is labelled with the
+// server URL, and with the profile name when a profile was used, so that
+// several servers can be checked into one textfile directory.
+func FormatDiffPrometheus(result *DiffResult, serverURL, profile string, now time.Time) string {
+	labels := [][2]string{{"server", serverURL}}
+	if profile != "" {
+		labels = append(labels, [2]string{"profile", profile})
+	}
+
+	var sb strings.Builder
+	metric := func(name, help string) {
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name))
+	}
+	sample := func(name string, value interface{}, extra ...[2]string) {
+		sb.WriteString(fmt.Sprintf("%s%s %v\n", name, prometheusLabels(append(labels[:len(labels):len(labels)], extra...)), value))
+	}
+
+	metric("mm_config_drift_detected", "Whether the configuration drifted from the baseline (1) or not (0).")
+	detected := 0
+	if result.DriftDetected {
+		detected = 1
+	}
+	sample("mm_config_drift_detected", detected)
+
+	// Every compared section is reported, so that a section's series drop
+	// to zero rather than disappear once its drift is resolved.
+	counts := make(map[string]*SummaryCounts)
+	for _, section := range resultSections(result) {
+		counts[section] = &SummaryCounts{}
+	}
+	for _, e := range result.Entries() {
+		counts[e.Section()].add(e.ChangeType)
+	}
+	metric("mm_config_drift_fields", "Settings that drifted from the baseline, by section and change type.")
+	for _, section := range resultSections(result) {
+		c := counts[section]
+		sample("mm_config_drift_fields", c.Changed, [2]string{"section", section}, [2]string{"change_type", "changed"})
+		sample("mm_config_drift_fields", c.Added, [2]string{"section", section}, [2]string{"change_type", "added"})
+		sample("mm_config_drift_fields", c.Removed, [2]string{"section", section}, [2]string{"change_type", "removed"})
+	}
+
+	metric("mm_config_drift_not_visible_fields", "Settings not compared because one capture could not read them.")
+	sample("mm_config_drift_not_visible_fields", len(result.NotVisible))
+
+	metric("mm_config_drift_snapshot_age_seconds", "Age of each compared snapshot at the time of the check.")
+	for _, side := range []struct {
+		name string
+		src  DiffSource
+	}{{"baseline", result.Baseline}, {"compared", result.Compared}} {
+		if t, err := time.Parse(time.RFC3339, side.src.CapturedAt); err == nil {
+			sample("mm_config_drift_snapshot_age_seconds", int64(now.Sub(t).Seconds()), [2]string{"snapshot", side.name})
+		} else if side.src.Source == "live" {
+			sample("mm_config_drift_snapshot_age_seconds", 0, [2]string{"snapshot", side.name})
+		}
+	}
+
+	metric("mm_config_drift_last_success_timestamp_seconds", "Unix time of the last successful drift check.")
+	sample("mm_config_drift_last_success_timestamp_seconds", now.Unix())
+
+	return sb.String()
+}
+
+// resultSections returns the config sections of every field a diff
+// result compared, in order.
+func resultSections(result *DiffResult) []string {
+	seen := make(map[string]bool)
+	for _, e := range result.Entries() {
+		seen[e.Section()] = true
+	}
+	for _, fields := range [][]string{result.Unchanged, result.Ignored} {
+		for _, f := range fields {
+			seen[configSection(f)] = true
+		}
+	}
+	for _, n := range result.NotVisible {
+		seen[configSection(n.Field)] = true
+	}
+	sections := make([]string, 0, len(seen))
+	for s := range seen {
+		sections = append(sections, s)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+func prometheusLabels(labels [][2]string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l[0], escape.Replace(l[1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// WriteTextfile writes metrics for the node_exporter textfile collector.
+// The file is written under a temporary name and renamed into place, so
+// that the collector never reads it half-written.
+func WriteTextfile(content, path string) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return NewExitError(ExitOutputError, fmt.Sprintf("error: unable to write metrics to %s", path), err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return NewExitError(ExitOutputError, fmt.Sprintf("error: unable to write metrics to %s", path), err)
+	}
+	return nil
+}
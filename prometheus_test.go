@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDiffPrometheus(t *testing.T) {
+	result := sampleDiffResult()
+	result.Baseline.CapturedAt = "2025-10-01T09:00:00Z"
+	result.Unchanged = []string{"SqlSettings.DriverName"}
+	now := time.Date(2025, 10, 1, 10, 0, 0, 0, time.UTC)
+
+	out := FormatDiffPrometheus(result, "https://mm.example.com", "prod", now)
+	for _, want := range []string{
+		"# TYPE mm_config_drift_detected gauge\n",
+		`mm_config_drift_detected{server="https://mm.example.com",profile="prod"} 1` + "\n",
+		`mm_config_drift_fields{server="https://mm.example.com",profile="prod",section="ServiceSettings",change_type="changed"} 2` + "\n",
+		`mm_config_drift_fields{server="https://mm.example.com",profile="prod",section="PluginSettings",change_type="added"} 1` + "\n",
+		`mm_config_drift_fields{server="https://mm.example.com",profile="prod",section="SqlSettings",change_type="changed"} 0` + "\n",
+		`mm_config_drift_snapshot_age_seconds{server="https://mm.example.com",profile="prod",snapshot="baseline"} 3600` + "\n",
+		`mm_config_drift_snapshot_age_seconds{server="https://mm.example.com",profile="prod",snapshot="compared"} 0` + "\n",
+		`mm_config_drift_last_success_timestamp_seconds{server="https://mm.example.com",profile="prod"} 1759312800` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Every sample line belongs to a metric with HELP and TYPE lines.
+	typed := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			typed[strings.Fields(name)[0]] = true
+		} else if !strings.HasPrefix(line, "# HELP ") && !typed[line[:strings.Index(line, "{")]] {
+			t.Errorf("sample without TYPE: %s", line)
+		}
+	}
+}
+
+func TestFormatDiffPrometheus_NoProfile(t *testing.T) {
+	result := &DiffResult{
+		Baseline: DiffSource{Source: "file", File: "a.json", CapturedAt: "unknown"},
+		Compared: DiffSource{Source: "file", File: "b.json", CapturedAt: "unknown"},
+	}
+	out := FormatDiffPrometheus(result, `https://mm.example.com/"x"`, "", time.Unix(0, 0))
+	if !strings.Contains(out, `mm_config_drift_detected{server="https://mm.example.com/\"x\""} 0`) {
+		t.Errorf("label values should be escaped, and profile omitted:\n%s", out)
+	}
+	if strings.Contains(out, "mm_config_drift_snapshot_age_seconds{") {
+		t.Errorf("snapshots without a capture time should have no age:\n%s", out)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drift.prom")
+	if err := WriteTextfile("metric 1\n", path); err != nil {
+		t.Fatalf("WriteTextfile() error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "metric 1\n" {
+		t.Errorf("content = %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file was left behind")
+	}
+
+	err := WriteTextfile("metric 1\n", filepath.Join(t.TempDir(), "missing", "drift.prom"))
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitOutputError {
+		t.Errorf("error = %v, want ExitOutputError", err)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// RecordingManifest is the manifest.json of a recording directory.
+type RecordingManifest struct {
+	Tool        string `json:"tool"`
+	ToolVersion string `json:"tool_version"`
+	ServerURL   string `json:"server_url"`
+	RecordedAt  string `json:"recorded_at"`
+}
+
+// RecordedExchange is one API request and its response, stored as a
+// numbered JSON file in a recording directory. Credentials and secrets are
+// scrubbed before it is written.
+type RecordedExchange struct {
+	Method          string            `json:"method"`
+	Host            string            `json:"host"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     json.RawMessage   `json:"request_body,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    json.RawMessage   `json:"response_body,omitempty"` // JSON bodies
+	ResponseText    string            `json:"response_text,omitempty"` // other bodies
+}
+
+// scrubbedHeaders carry credentials or session state, and are recorded as
+// RedactedValue.
+var scrubbedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Token":               true,
+	"X-Csrf-Token":        true,
+	"Proxy-Authorization": true,
+}
+
+// Recorder writes the API exchanges of one command to a directory, for
+// reproducing it later with --replay.
+type Recorder struct {
+	dir     string
+	version string
+
+	mu       sync.Mutex
+	seq      int
+	manifest bool
+}
+
+// NewRecorder creates the recording directory. An existing recording in it
+// is replaced.
+func NewRecorder(dir, version string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, NewExitError(ExitOutputError, fmt.Sprintf("error: unable to create recording directory %s", dir), err)
+	}
+	old, _ := filepath.Glob(filepath.Join(dir, "[0-9][0-9][0-9][0-9]-*.json"))
+	for _, path := range old {
+		os.Remove(path)
+	}
+	return &Recorder{dir: dir, version: version}, nil
+}
+
+// Wrap returns a transport that records the exchanges base carries for the
+// server at serverURL. The first server wrapped is the one --replay serves.
+func (r *Recorder) Wrap(base http.RoundTripper, serverURL string) http.RoundTripper {
+	return &recordingTransport{base: base, recorder: r, serverURL: serverURL}
+}
+
+func (r *Recorder) writeManifest(serverURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.manifest {
+		return nil
+	}
+	r.manifest = true
+	return writeJSONFile(filepath.Join(r.dir, "manifest.json"), RecordingManifest{
+		Tool:        "mm-config-diff",
+		ToolVersion: r.version,
+		ServerURL:   serverURL,
+		RecordedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (r *Recorder) write(ex *RecordedExchange) error {
+	r.mu.Lock()
+	r.seq++
+	seq := r.seq
+	r.mu.Unlock()
+
+	slug := strings.Trim(strings.NewReplacer("/", "-", ".", "-").Replace(ex.Path), "-")
+	name := fmt.Sprintf("%04d-%s-%s.json", seq, strings.ToLower(ex.Method), slug)
+	return writeJSONFile(filepath.Join(r.dir, name), ex)
+}
+
+type recordingTransport struct {
+	base      http.RoundTripper
+	recorder  *Recorder
+	serverURL string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.recorder.writeManifest(t.serverURL); err != nil {
+		return nil, NewExitError(ExitOutputError, "error: unable to write recording manifest", err)
+	}
+
+	ex := &RecordedExchange{
+		Method:         req.Method,
+		Host:           req.URL.Host,
+		Path:           req.URL.Path,
+		Query:          req.URL.RawQuery,
+		RequestHeaders: scrubHeaders(req.Header),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		ex.RequestBody, _ = scrubBody(body)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	ex.Status = resp.StatusCode
+	ex.ResponseHeaders = scrubHeaders(resp.Header)
+	if scrubbed, ok := scrubBody(body); ok {
+		ex.ResponseBody = scrubbed
+	} else {
+		ex.ResponseText = string(body)
+	}
+	if err := t.recorder.write(ex); err != nil {
+		return nil, NewExitError(ExitOutputError, "error: unable to write recorded exchange", err)
+	}
+	return resp, nil
+}
+
+func scrubHeaders(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(h))
+	for name, values := range h {
+		if scrubbedHeaders[http.CanonicalHeaderKey(name)] {
+			result[name] = RedactedValue
+			continue
+		}
+		result[name] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// scrubBody redacts secrets in a JSON body, by the same field names as
+// RedactConfig. It reports false if the body is not JSON.
+func scrubBody(body []byte) (json.RawMessage, bool) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, false
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, false
+	}
+	scrubSecrets(v, "")
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// scrubSecrets redacts sensitive fields in place. Unlike RedactConfig it
+// keeps each value's JSON type, so that a replayed body still decodes into
+// the model types: strings become RedactedValue, and arrays and objects
+// have their strings redacted.
+func scrubSecrets(v interface{}, prefix string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			if shouldRedact(path) {
+				val[k] = redactPreservingType(child)
+				continue
+			}
+			scrubSecrets(child, path)
+		}
+	case []interface{}:
+		for _, child := range val {
+			scrubSecrets(child, prefix)
+		}
+	}
+}
+
+func redactPreservingType(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		if val == "" {
+			return val
+		}
+		return RedactedValue
+	case []interface{}:
+		for i := range val {
+			val[i] = redactPreservingType(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = redactPreservingType(val[k])
+		}
+	}
+	return v
+}
+
+// ReplayClient implements MattermostClient by serving the responses of a
+// recording made with --record, without network access or credentials.
+type ReplayClient struct {
+	client    *model.Client4
+	serverURL string
+}
+
+// NewReplayClient loads the recording in dir.
+func NewReplayClient(dir string) (*ReplayClient, error) {
+	var manifest RecordingManifest
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: %s is not a recording made with --record", dir), err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: recording manifest in %s is not valid JSON", dir), err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "[0-9][0-9][0-9][0-9]-*.json"))
+	sort.Strings(paths)
+	transport := &replayTransport{dir: dir, exchanges: make(map[string][]*RecordedExchange)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read recorded exchange %s", path), err)
+		}
+		var ex RecordedExchange
+		if err := json.Unmarshal(data, &ex); err != nil {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: recorded exchange %s is not valid JSON", path), err)
+		}
+		key := replayKey(ex.Method, ex.Path, ex.Query)
+		transport.exchanges[key] = append(transport.exchanges[key], &ex)
+	}
+
+	client := model.NewAPIv4Client(manifest.ServerURL)
+	client.HTTPClient = &http.Client{Transport: transport}
+	return &ReplayClient{client: client, serverURL: manifest.ServerURL}, nil
+}
+
+// GetConfig returns the recorded configuration. For a recording made in
+// local mode, the server is then identified by its SiteURL, as it is by
+// LocalClient.
+func (c *ReplayClient) GetConfig(ctx context.Context) (map[string]interface{}, error) {
+	config, err := fetchConfig(ctx, c.client, c.serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(c.serverURL, "unix://") && siteURL(config) != "" {
+		c.serverURL = siteURL(config)
+	}
+	return config, nil
+}
+
+// ServerURL returns the URL of the recorded server.
+func (c *ReplayClient) ServerURL() string {
+	return c.serverURL
+}
+
+// ClusterStatus returns the recorded cluster status.
+func (c *ReplayClient) ClusterStatus(ctx context.Context) ([]*model.ClusterInfo, error) {
+	return fetchClusterStatus(ctx, c.client, c.serverURL)
+}
+
+// ReadPermissions returns the recorded account's permissions, or nil if
+// it could read the whole configuration.
+func (c *ReplayClient) ReadPermissions(ctx context.Context) (map[string]bool, error) {
+	return readPermissions(ctx, c.client, c.serverURL)
+}
+
+// NotRecordedError is returned for a request the recording has no
+// response for.
+type NotRecordedError struct {
+	Method, Path string
+}
+
+func (e *NotRecordedError) Error() string {
+	return fmt.Sprintf("no recorded response for %s %s", e.Method, e.Path)
+}
+
+// replayTransport serves recorded responses. Exchanges for the same
+// request are served in recorded order, the last one repeating.
+type replayTransport struct {
+	dir       string
+	mu        sync.Mutex
+	exchanges map[string][]*RecordedExchange
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := replayKey(req.Method, req.URL.Path, req.URL.RawQuery)
+	t.mu.Lock()
+	queue := t.exchanges[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, &NotRecordedError{Method: req.Method, Path: req.URL.Path}
+	}
+	ex := queue[0]
+	if len(queue) > 1 {
+		t.exchanges[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	resp := &http.Response{
+		StatusCode: ex.Status,
+		Status:     fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	for name, value := range ex.ResponseHeaders {
+		resp.Header.Set(name, value)
+	}
+	// Scrubbing may have changed the body's length.
+	resp.Header.Del("Content-Length")
+	body := []byte(ex.ResponseText)
+	if len(ex.ResponseBody) > 0 {
+		body = ex.ResponseBody
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+func replayKey(method, path, query string) string {
+	return method + " " + path + "?" + query
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
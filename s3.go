@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures access to an S3-compatible object store.
+type S3Options struct {
+	Endpoint     string // custom endpoint (e.g. MinIO); empty for AWS
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// Server-side encryption: "AES256" or "aws:kms", with an optional KMS key.
+	SSE      string
+	KMSKeyID string
+
+	// Object lock: "GOVERNANCE" or "COMPLIANCE", retained for RetainDays.
+	ObjectLockMode       string
+	ObjectLockRetainDays int
+
+	// HTTPClient sends the requests; nil uses a client that times out
+	// after DefaultTimeout.
+	HTTPClient *http.Client
+}
+
+// S3OptionsFromEnv returns S3Options populated from the standard AWS
+// environment variables.
+func S3OptionsFromEnv() S3Options {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	return S3Options{
+		Endpoint:     endpoint,
+		Region:       region,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// S3Backend is a StorageBackend for s3:// URIs. Requests are signed with AWS
+// Signature Version 4. With a custom endpoint, path-style addressing is used
+// so that MinIO and similar servers work without DNS setup.
+type S3Backend struct {
+	opts       S3Options
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewS3Backend creates an S3Backend.
+func NewS3Backend(opts S3Options) (*S3Backend, error) {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	opts.SSE = strings.TrimSpace(opts.SSE)
+	opts.ObjectLockMode = strings.ToUpper(strings.TrimSpace(opts.ObjectLockMode))
+
+	switch opts.SSE {
+	case "", "AES256", "aws:kms":
+	default:
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported S3 server-side encryption %q. Use 'AES256' or 'aws:kms'.", opts.SSE), nil)
+	}
+	if opts.KMSKeyID != "" && opts.SSE != "aws:kms" {
+		return nil, NewExitError(ExitConfigError, "error: --s3-sse-kms-key-id requires --s3-sse aws:kms.", nil)
+	}
+	switch opts.ObjectLockMode {
+	case "":
+		if opts.ObjectLockRetainDays > 0 {
+			return nil, NewExitError(ExitConfigError, "error: --s3-object-lock-retain-days requires --s3-object-lock-mode.", nil)
+		}
+	case "GOVERNANCE", "COMPLIANCE":
+		if opts.ObjectLockRetainDays <= 0 {
+			return nil, NewExitError(ExitConfigError, "error: --s3-object-lock-mode requires a positive --s3-object-lock-retain-days.", nil)
+		}
+	default:
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported S3 object lock mode %q. Use 'GOVERNANCE' or 'COMPLIANCE'.", opts.ObjectLockMode), nil)
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &S3Backend{opts: opts, httpClient: client, now: time.Now}, nil
+}
+
+// Get downloads an object.
+func (b *S3Backend) Get(ctx context.Context, uri string) ([]byte, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Put uploads an object, applying the configured encryption and object lock
+// settings.
+func (b *S3Backend) Put(ctx context.Context, uri string, data []byte, contentType string) error {
+	req, err := b.newRequest(ctx, http.MethodPut, uri, data)
+	if err != nil {
+		return err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// Content-MD5 is mandatory for uploads to buckets with object lock.
+	sum := md5.Sum(data)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+
+	if b.opts.SSE != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption", b.opts.SSE)
+	}
+	if b.opts.KMSKeyID != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", b.opts.KMSKeyID)
+	}
+	if b.opts.ObjectLockMode != "" {
+		retainUntil := b.now().UTC().AddDate(0, 0, b.opts.ObjectLockRetainDays)
+		req.Header.Set("X-Amz-Object-Lock-Mode", b.opts.ObjectLockMode)
+		req.Header.Set("X-Amz-Object-Lock-Retain-Until-Date", retainUntil.Format(time.RFC3339))
+	}
+
+	resp, err := b.do(req, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// newRequest builds an unsigned request for an s3:// URI.
+func (b *S3Backend) newRequest(ctx context.Context, method, uri string, body []byte) (*http.Request, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bucket names with dots cannot be virtual hosts under the
+	// *.s3.<region>.amazonaws.com certificate, so they use path style.
+	var target string
+	switch {
+	case b.opts.Endpoint != "":
+		target = fmt.Sprintf("%s/%s/%s", b.opts.Endpoint, bucket, s3EscapePath(key))
+	case strings.Contains(bucket, "."):
+		target = fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", b.opts.Region, bucket, s3EscapePath(key))
+	default:
+		target = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, b.opts.Region, s3EscapePath(key))
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 request for %s: %w", uri, err)
+	}
+	return req, nil
+}
+
+// do signs and sends a request, converting S3 error responses into errors.
+func (b *S3Backend) do(req *http.Request, body []byte) (*http.Response, error) {
+	if b.opts.AccessKey == "" || b.opts.SecretKey == "" {
+		return nil, fmt.Errorf("S3 credentials are not configured (set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if b.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.opts.SessionToken)
+	}
+	signS3Request(req, body, b.opts.AccessKey, b.opts.SecretKey, b.opts.Region, b.now().UTC())
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return nil, fmt.Errorf("S3 returned HTTP %d: %s: %s", resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("S3 returned HTTP %d", resp.StatusCode)
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req. All headers
+// already set on the request are signed, along with Host.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// parseS3URI splits s3://bucket/key into its bucket and key.
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("not an s3:// URI: %s", uri)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("S3 URI %s must name a bucket and an object key", uri)
+	}
+	return bucket, key, nil
+}
+
+// s3EscapePath URI-encodes an object key as Signature Version 4 expects:
+// everything except unreserved characters and "/" is percent-encoded.
+func s3EscapePath(key string) string {
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
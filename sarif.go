@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifToolURI = "https://github.com/jlandells/mm-config-diff"
+
+	// sarifRulePrefix namespaces rule IDs, which are the setting path, so
+	// that a setting keeps its rule ID from run to run.
+	sarifRulePrefix = "mm-config-diff/"
+)
+
+// sarifLevels map drift severities to SARIF result levels.
+var sarifLevels = map[string]string{
+	SeverityHigh:   "error",
+	SeverityMedium: "warning",
+	SeverityLow:    "note",
+}
+
+// sarifSecuritySeverities are the scores code-scanning dashboards such as
+// GitHub's use to rank security findings.
+var sarifSecuritySeverities = map[string]string{
+	SeverityHigh:   "8.0",
+	SeverityMedium: "5.0",
+	SeverityLow:    "2.0",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	DefaultConfiguration sarifRuleConfig     `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties"`
+}
+
+type sarifRuleConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifRuleProperties struct {
+	SecuritySeverity string   `json:"security-severity"`
+	Tags             []string `json:"tags"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints"`
+	Properties          map[string]interface{} `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// FormatDiffSARIF produces a SARIF 2.1.0 log for a diff result, with one
+// result per changed, added or removed setting. Each setting path has its
+// own rule, so that code-scanning systems track a drifted setting as the
+// same finding across runs. Locations point at the setting in the baseline
+// snapshot: baselineURI names the file, and baselineJSON, if given, is its
+// content, used to find the line of each setting.
+func FormatDiffSARIF(result *DiffResult, baselineURI string, baselineJSON []byte, toolVersion string) (string, error) {
+	lines := jsonKeyLines(baselineJSON)
+	uri := filepath.ToSlash(baselineURI)
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "mm-config-diff",
+			Version:        toolVersion,
+			InformationURI: sarifToolURI,
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, e := range result.Entries() {
+		severity := FieldSeverity(e.Field)
+		ruleID := sarifRulePrefix + e.Field
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   ruleID,
+			Name:                 e.Field,
+			ShortDescription:     sarifMessage{Text: fmt.Sprintf("Drift in %s", e.Field)},
+			DefaultConfiguration: sarifRuleConfig{Level: sarifLevels[severity]},
+			Properties: sarifRuleProperties{
+				SecuritySeverity: sarifSecuritySeverities[severity],
+				Tags:             []string{"configuration-drift", e.Section()},
+			},
+		})
+
+		location := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}},
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: e.Field, Kind: "member"}},
+		}
+		if line := settingLine(lines, e.Field); line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: line}
+		}
+
+		properties := map[string]interface{}{"changeType": e.ChangeType, "severity": severity}
+		if e.ChangeType != "added" {
+			properties["before"] = e.Before
+		}
+		if e.ChangeType != "removed" {
+			properties["after"] = e.After
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:              ruleID,
+			RuleIndex:           len(run.Tool.Driver.Rules) - 1,
+			Level:               sarifLevels[severity],
+			Message:             sarifMessage{Text: sarifText(e, result.Compared)},
+			Locations:           []sarifLocation{location},
+			PartialFingerprints: map[string]string{"settingPath/v1": e.Field},
+			Properties:          properties,
+		})
+	}
+
+	data, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to marshal SARIF log", err)
+	}
+	return string(data) + "\n", nil
+}
+
+func sarifText(e DiffEntry, compared DiffSource) string {
+	return fmt.Sprintf("%s in %s.", e.Describe(), formatSource(compared))
+}
+
+// SARIFBaseline returns the URI of the baseline snapshot for SARIF
+// locations, and its content for finding setting lines. A baseline that is
+// not a local file is located by its reference, and its content is the
+// snapshot as this tool writes it.
+func SARIFBaseline(ref string, src DiffSource, config map[string]interface{}) (string, []byte) {
+	uri := ref
+	switch src.Source {
+	case "file":
+		if data, err := os.ReadFile(ref); err == nil {
+			return uri, data
+		}
+	case "git":
+		if _, filePath, ok := strings.Cut(ref, ":"); ok {
+			uri = filePath
+		}
+	case "store":
+		uri = src.File
+	}
+	data, _ := marshalSnapshot(config)
+	return uri, data
+}
+
+// settingLine returns the line of a setting in the baseline, or of its
+// nearest enclosing object for a setting the baseline lacks. It returns 0
+// if none is found.
+func settingLine(lines map[string]int, path string) int {
+	for path != "" {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return 0
+}
+
+// jsonKeyLines returns the 1-based line on which each object key of a JSON
+// document appears, by dot-notation path. It returns what it found so far
+// if the document is malformed.
+func jsonKeyLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// Each frame is an open object (with the path of its members and
+	// whether a key is expected next) or an open array.
+	type frame struct {
+		object    bool
+		path      string
+		expectKey bool
+		key       string
+	}
+	var stack []*frame
+	line, scanned := 1, 0
+
+	valueDone := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+	childPath := func() string {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			top := stack[n-1]
+			if top.path == "" {
+				return top.key
+			}
+			return top.path + "." + top.key
+		}
+		if n := len(stack); n > 0 {
+			return stack[n-1].path
+		}
+		return ""
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+		offset := int(dec.InputOffset())
+		line += bytes.Count(data[scanned:offset], []byte("\n"))
+		scanned = offset
+
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &frame{object: true, path: childPath(), expectKey: true})
+			case '[':
+				stack = append(stack, &frame{path: childPath()})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		default:
+			if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+				top := stack[n-1]
+				top.key, top.expectKey = t.(string), false
+				lines[childPath()] = line
+				continue
+			}
+			valueDone()
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sarifBaselineJSON = `{
+  "_metadata": {
+    "server_url": "https://mm.example.com"
+  },
+  "PluginSettings": {
+    "Enable": true
+  },
+  "ServiceSettings": {
+    "AllowCorsFrom": "",
+    "MaximumLoginAttempts": 10
+  },
+  "TeamSettings": {
+    "ExperimentalDefaultChannels": [
+      "town-square"
+    ]
+  }
+}
+`
+
+func TestFormatDiffSARIF(t *testing.T) {
+	out, err := FormatDiffSARIF(sampleDiffResult(), "snapshots/baseline.json", []byte(sarifBaselineJSON), "1.2.3")
+	if err != nil {
+		t.Fatalf("FormatDiffSARIF() error: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, out)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("version = %q, runs = %d", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "mm-config-diff" || run.Tool.Driver.Version != "1.2.3" {
+		t.Errorf("driver = %+v", run.Tool.Driver)
+	}
+	if len(run.Results) != 4 || len(run.Tool.Driver.Rules) != 4 {
+		t.Fatalf("results = %d, rules = %d, want 4 each", len(run.Results), len(run.Tool.Driver.Rules))
+	}
+
+	byRule := make(map[string]sarifResult)
+	for _, r := range run.Results {
+		if rule := run.Tool.Driver.Rules[r.RuleIndex]; rule.ID != r.RuleID {
+			t.Errorf("result %s has rule index of %s", r.RuleID, rule.ID)
+		}
+		byRule[r.RuleID] = r
+	}
+
+	tests := []struct {
+		ruleID string
+		level  string
+		line   int
+	}{
+		{"mm-config-diff/ServiceSettings.MaximumLoginAttempts", "error", 10},
+		{"mm-config-diff/ServiceSettings.AllowCorsFrom", "error", 9},
+		{"mm-config-diff/TeamSettings.ExperimentalDefaultChannels", "warning", 13},
+		// Not in the baseline: located at its section.
+		{"mm-config-diff/PluginSettings.PluginStates", "warning", 5},
+	}
+	for _, tt := range tests {
+		r, ok := byRule[tt.ruleID]
+		if !ok {
+			t.Errorf("no result for rule %s", tt.ruleID)
+			continue
+		}
+		if r.Level != tt.level {
+			t.Errorf("%s level = %q, want %q", tt.ruleID, r.Level, tt.level)
+		}
+		loc := r.Locations[0].PhysicalLocation
+		if loc.ArtifactLocation.URI != "snapshots/baseline.json" {
+			t.Errorf("%s uri = %q", tt.ruleID, loc.ArtifactLocation.URI)
+		}
+		if loc.Region == nil || loc.Region.StartLine != tt.line {
+			t.Errorf("%s region = %+v, want line %d", tt.ruleID, loc.Region, tt.line)
+		}
+	}
+
+	r := byRule["mm-config-diff/ServiceSettings.MaximumLoginAttempts"]
+	if want := "ServiceSettings.MaximumLoginAttempts changed from 10 to 5 in live instance at https://mm.example.com (captured now)."; r.Message.Text != want {
+		t.Errorf("message = %q, want %q", r.Message.Text, want)
+	}
+	if r.PartialFingerprints["settingPath/v1"] != "ServiceSettings.MaximumLoginAttempts" {
+		t.Errorf("fingerprints = %v", r.PartialFingerprints)
+	}
+}
+
+func TestFormatDiffSARIFNoDrift(t *testing.T) {
+	out, err := FormatDiffSARIF(&DiffResult{}, "baseline.json", nil, "dev")
+	if err != nil {
+		t.Fatalf("FormatDiffSARIF() error: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal([]byte(out), &log); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	// Code-scanning uploads need an explicit empty results array to close
+	// earlier findings.
+	var raw map[string][]map[string]json.RawMessage
+	json.Unmarshal([]byte(out), &raw)
+	if got := string(raw["runs"][0]["results"]); got != "[]" {
+		t.Errorf("results = %s, want []", got)
+	}
+}
+
+func TestJSONKeyLines(t *testing.T) {
+	lines := jsonKeyLines([]byte(sarifBaselineJSON))
+	want := map[string]int{
+		"_metadata":                                2,
+		"_metadata.server_url":                     3,
+		"PluginSettings.Enable":                    6,
+		"ServiceSettings":                          8,
+		"TeamSettings.ExperimentalDefaultChannels": 13,
+	}
+	for path, line := range want {
+		if lines[path] != line {
+			t.Errorf("line of %s = %d, want %d", path, lines[path], line)
+		}
+	}
+
+	if got := jsonKeyLines([]byte(`{"a": {"b": `)); got["a.b"] != 1 {
+		t.Errorf("malformed document: got %v", got)
+	}
+}
+
+func TestSARIFBaseline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baseline.json")
+	os.WriteFile(path, []byte(sarifBaselineJSON), 0644)
+	config := map[string]interface{}{"ServiceSettings": map[string]interface{}{"SiteURL": "x"}}
+
+	uri, data := SARIFBaseline(path, DiffSource{Source: "file"}, config)
+	if uri != path || string(data) != sarifBaselineJSON {
+		t.Errorf("file: uri = %q, data = %q", uri, data)
+	}
+
+	uri, data = SARIFBaseline("HEAD~1:snapshots/prod.json", DiffSource{Source: "git"}, config)
+	if uri != "snapshots/prod.json" || jsonKeyLines(data)["ServiceSettings.SiteURL"] != 3 {
+		t.Errorf("git: uri = %q, data = %s", uri, data)
+	}
+
+	uri, _ = SARIFBaseline("latest", DiffSource{Source: "store", File: "2025-10-01T090000Z.json"}, config)
+	if uri != "2025-10-01T090000Z.json" {
+		t.Errorf("store: uri = %q", uri)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+)
+
+// Severity levels assigned to drifted settings.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+)
+
+// severityRules map dot-notation path prefixes to severities. The longest
+// matching prefix wins; paths matching no rule are low severity.
+var severityRules = map[string]string{
+	// Authentication, identity and access control.
+	"PasswordSettings":      SeverityHigh,
+	"LdapSettings":          SeverityHigh,
+	"SamlSettings":          SeverityHigh,
+	"GitLabSettings":        SeverityHigh,
+	"GoogleSettings":        SeverityHigh,
+	"Office365Settings":     SeverityHigh,
+	"OpenIdSettings":        SeverityHigh,
+	"GuestAccountsSettings": SeverityHigh,
+	"ComplianceSettings":    SeverityHigh,
+	"DataRetentionSettings": SeverityHigh,
+	"MessageExportSettings": SeverityHigh,
+
+	"ServiceSettings.EnableMultifactorAuthentication":     SeverityHigh,
+	"ServiceSettings.EnforceMultifactorAuthentication":    SeverityHigh,
+	"ServiceSettings.MaximumLoginAttempts":                SeverityHigh,
+	"ServiceSettings.SessionLengthWebInHours":             SeverityHigh,
+	"ServiceSettings.SessionLengthWebInHoursMobile":       SeverityHigh,
+	"ServiceSettings.SessionLengthMobileInHours":          SeverityHigh,
+	"ServiceSettings.SessionLengthSSOInHours":             SeverityHigh,
+	"ServiceSettings.SessionIdleTimeoutInMinutes":         SeverityHigh,
+	"ServiceSettings.EnableInsecureOutgoingConnections":   SeverityHigh,
+	"ServiceSettings.AllowCorsFrom":                       SeverityHigh,
+	"ServiceSettings.EnableUserAccessTokens":              SeverityHigh,
+	"ServiceSettings.ConnectionSecurity":                  SeverityHigh,
+	"ServiceSettings.TLSMinVer":                           SeverityHigh,
+	"ServiceSettings.AllowedUntrustedInternalConnections": SeverityHigh,
+	"EmailSettings.EnableSignUpWithEmail":                 SeverityHigh,
+	"EmailSettings.RequireEmailVerification":              SeverityHigh,
+	"TeamSettings.EnableOpenServer":                       SeverityHigh,
+	"TeamSettings.RestrictCreationToDomains":              SeverityHigh,
+	"FileSettings.EnablePublicLink":                       SeverityHigh,
+	"PluginSettings.EnableUploads":                        SeverityHigh,
+	"PluginSettings.RequirePluginSignature":               SeverityHigh,
+	"SqlSettings.DataSource":                              SeverityHigh,
+
+	// Operationally significant sections.
+	"ServiceSettings":           SeverityMedium,
+	"TeamSettings":              SeverityMedium,
+	"EmailSettings":             SeverityMedium,
+	"FileSettings":              SeverityMedium,
+	"SqlSettings":               SeverityMedium,
+	"PluginSettings":            SeverityMedium,
+	"ClusterSettings":           SeverityMedium,
+	"RateLimitSettings":         SeverityMedium,
+	"PrivacySettings":           SeverityMedium,
+	"LogSettings":               SeverityMedium,
+	"ExperimentalAuditSettings": SeverityMedium,
+}
+
+// FieldSeverity returns the severity of a drift in the setting at dotPath.
+func FieldSeverity(dotPath string) string {
+	best, severity := -1, SeverityLow
+	for prefix, s := range severityRules {
+		if len(prefix) > best && (dotPath == prefix || strings.HasPrefix(dotPath, prefix+".")) {
+			best, severity = len(prefix), s
+		}
+	}
+	return severity
+}
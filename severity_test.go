@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestFieldSeverity(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"PasswordSettings.MinimumLength", SeverityHigh},
+		{"ServiceSettings.MaximumLoginAttempts", SeverityHigh},
+		{"ServiceSettings.SiteURL", SeverityMedium},
+		{"PluginSettings.EnableUploads", SeverityHigh},
+		{"PluginSettings.Plugins.com.mattermost.nps.enabled", SeverityMedium},
+		{"DisplaySettings.CustomURLSchemes", SeverityLow},
+		{"ServiceSettingsExtra.Foo", SeverityLow},
+		{"PasswordSettings", SeverityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := FieldSeverity(tt.path); got != tt.want {
+				t.Errorf("FieldSeverity(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -16,6 +16,13 @@ type SnapshotMetadata struct {
 	ToolVersion string `json:"tool_version"`
 	ServerURL   string `json:"server_url"`
 	CapturedAt  string `json:"captured_at"`
+	LocalSocket string `json:"local_socket,omitempty"`
+
+	// Partial is set when the capturing account could not read the whole
+	// config. VisibleSections then lists the sections it could read in
+	// full, which may be none.
+	Partial         bool     `json:"partial,omitempty"`
+	VisibleSections []string `json:"visible_sections,omitempty"`
 }
 
 // TakeSnapshot fetches the config from the API, redacts sensitive fields,
@@ -26,30 +33,51 @@ func TakeSnapshot(ctx context.Context, client MattermostClient, version string)
 		return nil, err
 	}
 
-	RedactConfig(config)
-
 	metadata := SnapshotMetadata{
 		Tool:        "mm-config-diff",
 		ToolVersion: version,
 		ServerURL:   client.ServerURL(),
 		CapturedAt:  time.Now().UTC().Format(time.RFC3339),
 	}
+	if local, ok := client.(interface{ LocalSocket() string }); ok {
+		metadata.LocalSocket = local.LocalSocket()
+	}
+	if reader, ok := client.(permissionReader); ok {
+		// Without system_admin, the server leaves out the settings the
+		// account's sysconsole_read permissions do not cover.
+		permissions, err := reader.ReadPermissions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if permissions != nil {
+			if visible, partial := FilterHiddenFields(config, permissions); partial {
+				metadata.Partial, metadata.VisibleSections = true, visible
+				fmt.Fprintf(os.Stderr, "warning: the account can read only part of the configuration (%d sections in full). Settings it cannot read are reported as not visible rather than removed.\n", len(visible))
+			}
+		}
+	}
+
+	RedactConfig(config)
+	injectMetadata(config, metadata)
+
+	return config, nil
+}
 
+// injectMetadata stores metadata in the config's _metadata key.
+func injectMetadata(config map[string]interface{}, metadata SnapshotMetadata) {
 	// Convert metadata struct to map for injection.
 	metaData, _ := json.Marshal(metadata)
 	var metaMap map[string]interface{}
 	json.Unmarshal(metaData, &metaMap)
 
 	config["_metadata"] = metaMap
-
-	return config, nil
 }
 
 // WriteSnapshot writes the snapshot map to a JSON file and returns the absolute path.
 func WriteSnapshot(snapshot map[string]interface{}, outputPath string) (string, error) {
-	data, err := json.MarshalIndent(snapshot, "", "  ")
+	data, err := marshalSnapshot(snapshot)
 	if err != nil {
-		return "", NewExitError(ExitOutputError, "error: failed to marshal snapshot to JSON", err)
+		return "", err
 	}
 
 	if err := os.WriteFile(outputPath, data, 0644); err != nil {
@@ -63,6 +91,15 @@ func WriteSnapshot(snapshot map[string]interface{}, outputPath string) (string,
 	return absPath, nil
 }
 
+// marshalSnapshot serialises a snapshot in the on-disk snapshot format.
+func marshalSnapshot(snapshot map[string]interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, NewExitError(ExitOutputError, "error: failed to marshal snapshot to JSON", err)
+	}
+	return data, nil
+}
+
 // LoadSnapshot reads a snapshot file, validates its metadata, and returns
 // the config map along with the parsed metadata.
 func LoadSnapshot(filePath string) (map[string]interface{}, *SnapshotMetadata, error) {
@@ -70,35 +107,51 @@ func LoadSnapshot(filePath string) (map[string]interface{}, *SnapshotMetadata, e
 	if err != nil {
 		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read snapshot file %s", filePath), err)
 	}
+	return ParseSnapshot(data, filePath)
+}
 
+// ParseSnapshot parses snapshot JSON, validates its metadata, and returns
+// the config map along with the parsed metadata. The name identifies the
+// snapshot in error messages.
+func ParseSnapshot(data []byte, name string) (map[string]interface{}, *SnapshotMetadata, error) {
 	var config map[string]interface{}
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s is not valid JSON", filePath), err)
+		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s is not valid JSON", name), err)
+	}
+
+	metadata, err := snapshotMetadata(config, name)
+	if err != nil {
+		return nil, nil, err
 	}
+	return config, metadata, nil
+}
 
+// snapshotMetadata validates and extracts the _metadata of a snapshot map.
+func snapshotMetadata(config map[string]interface{}, name string) (*SnapshotMetadata, error) {
 	metaRaw, ok := config["_metadata"]
 	if !ok {
-		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s is missing _metadata. Is this a valid mm-config-diff snapshot?", filePath), nil)
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s is missing _metadata. Is this a valid mm-config-diff snapshot?", name), nil)
 	}
 
 	metaMap, ok := metaRaw.(map[string]interface{})
 	if !ok {
-		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s has invalid _metadata format", filePath), nil)
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s has invalid _metadata format", name), nil)
 	}
 
 	toolName, _ := metaMap["tool"].(string)
 	if toolName != "mm-config-diff" {
-		return nil, nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s was not created by mm-config-diff (tool: %q)", filePath, toolName), nil)
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: snapshot file %s was not created by mm-config-diff (tool: %q)", name, toolName), nil)
 	}
 
-	metadata := &SnapshotMetadata{
-		Tool:        toolName,
-		ToolVersion: stringFromMap(metaMap, "tool_version"),
-		ServerURL:   stringFromMap(metaMap, "server_url"),
-		CapturedAt:  stringFromMap(metaMap, "captured_at"),
-	}
-
-	return config, metadata, nil
+	return &SnapshotMetadata{
+		Tool:            toolName,
+		ToolVersion:     stringFromMap(metaMap, "tool_version"),
+		ServerURL:       stringFromMap(metaMap, "server_url"),
+		CapturedAt:      stringFromMap(metaMap, "captured_at"),
+		LocalSocket:     stringFromMap(metaMap, "local_socket"),
+		Partial:         metaMap["partial"] == true,
+		VisibleSections: stringsFromMap(metaMap, "visible_sections"),
+	}, nil
 }
 
 // DefaultSnapshotFilename generates a default filename based on the current timestamp.
@@ -112,3 +165,22 @@ func stringFromMap(m map[string]interface{}, key string) string {
 	v, _ := m[key].(string)
 	return v
 }
+
+func stringsFromMap(m map[string]interface{}, key string) []string {
+	values, _ := m[key].([]interface{})
+	var result []string
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// snapshotTime returns the capture time recorded in a snapshot's metadata,
+// or the zero time if it is missing or malformed.
+func snapshotTime(snapshot map[string]interface{}) time.Time {
+	metaMap, _ := snapshot["_metadata"].(map[string]interface{})
+	t, _ := time.Parse(time.RFC3339, stringFromMap(metaMap, "captured_at"))
+	return t
+}
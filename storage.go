@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StorageBackend reads and writes whole objects addressed by URI, such as
+// s3://bucket/prefix/snapshot.json.
+type StorageBackend interface {
+	Get(ctx context.Context, uri string) ([]byte, error)
+	Put(ctx context.Context, uri string, data []byte, contentType string) error
+}
+
+// StorageBackends maps URI schemes to the backends that serve them.
+type StorageBackends map[string]StorageBackend
+
+// For returns the backend for uri, or nil if uri is a local path.
+func (b StorageBackends) For(uri string) StorageBackend {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil
+	}
+	return b[scheme]
+}
+
+// IsStorageURI reports whether s looks like a remote storage URI rather than
+// a local path.
+func IsStorageURI(s string) bool {
+	return strings.HasPrefix(s, "s3://")
+}
+
+// WriteSnapshotTo writes a snapshot to a local path or storage URI and
+// returns the absolute path or URI written. A URI ending in "/" is treated
+// as a prefix and the default snapshot filename is appended.
+func WriteSnapshotTo(ctx context.Context, backends StorageBackends, snapshot map[string]interface{}, output string) (string, error) {
+	if !IsStorageURI(output) {
+		return WriteSnapshot(snapshot, output)
+	}
+
+	backend := backends.For(output)
+	if backend == nil {
+		return "", NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported storage URI %s", output), nil)
+	}
+	if strings.HasSuffix(output, "/") {
+		output += DefaultSnapshotFilename()
+	}
+
+	data, err := marshalSnapshot(snapshot)
+	if err != nil {
+		return "", err
+	}
+	if err := backend.Put(ctx, output, data, "application/json"); err != nil {
+		return "", NewExitError(ExitOutputError, fmt.Sprintf("error: unable to write snapshot to %s", output), err)
+	}
+	return output, nil
+}
+
+// WriteOutputTo writes report content to a storage URI, or behaves like
+// WriteOutput for local paths and stdout. As with WriteOutput, a failed
+// remote write falls back to stdout with a warning.
+func WriteOutputTo(ctx context.Context, backends StorageBackends, content, output, contentType string) error {
+	if !IsStorageURI(output) {
+		return WriteOutput(content, output)
+	}
+
+	backend := backends.For(output)
+	if backend == nil {
+		return NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported storage URI %s", output), nil)
+	}
+	if err := backend.Put(ctx, output, []byte(content), contentType); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: unable to write to %s, writing to stdout instead: %v\n", output, err)
+		fmt.Print(content)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSnapshot(capturedAt string, maxLogin float64) map[string]interface{} {
+	return map[string]interface{}{
+		"_metadata": map[string]interface{}{
+			"tool":         "mm-config-diff",
+			"tool_version": "1.0.0",
+			"server_url":   "https://mm.example.com",
+			"captured_at":  capturedAt,
+		},
+		"ServiceSettings": map[string]interface{}{
+			"MaximumLoginAttempts": maxLogin,
+		},
+	}
+}
+
+func TestStore_AddAndReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := CreateStore(dir)
+	if err != nil {
+		t.Fatalf("CreateStore failed: %v", err)
+	}
+
+	// Added out of order; the index keeps them sorted by capture time.
+	for _, ts := range []string{"2025-10-02T09:00:00Z", "2025-10-01T09:00:00Z"} {
+		if _, err := store.Add(testSnapshot(ts, 10)); err != nil {
+			t.Fatalf("Add(%s) failed: %v", ts, err)
+		}
+	}
+
+	reopened, err := OpenStore(dir)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	entries := reopened.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].ID != "2025-10-01T09-00-00Z" || entries[1].ID != "2025-10-02T09-00-00Z" {
+		t.Errorf("entries not sorted by capture time: %s, %s", entries[0].ID, entries[1].ID)
+	}
+	if entries[0].ServerURL != "https://mm.example.com" {
+		t.Errorf("ServerURL = %q", entries[0].ServerURL)
+	}
+
+	_, meta, err := reopened.Load(entries[1])
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if meta.CapturedAt != "2025-10-02T09:00:00Z" {
+		t.Errorf("CapturedAt = %q", meta.CapturedAt)
+	}
+}
+
+func TestStore_DuplicateTimestamp(t *testing.T) {
+	store, err := CreateStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateStore failed: %v", err)
+	}
+	first, _ := store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+	second, err := store.Add(testSnapshot("2025-10-01T09:00:00Z", 5))
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Errorf("duplicate IDs: %s", first.ID)
+	}
+	if _, err := os.Stat(store.Path(*second)); err != nil {
+		t.Errorf("second snapshot file missing: %v", err)
+	}
+}
+
+func TestStore_Resolve(t *testing.T) {
+	store, err := CreateStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateStore failed: %v", err)
+	}
+	for _, ts := range []string{"2025-10-01T09:00:00Z", "2025-10-02T09:00:00Z", "2025-10-03T09:00:00Z"} {
+		store.Add(testSnapshot(ts, 10))
+	}
+
+	tests := []struct {
+		ref    string
+		wantID string
+	}{
+		{"latest", "2025-10-03T09-00-00Z"},
+		{"latest~0", "2025-10-03T09-00-00Z"},
+		{"latest~2", "2025-10-01T09-00-00Z"},
+		{"2025-10-02T09-00-00Z", "2025-10-02T09-00-00Z"},
+		{"2025-10-02", "2025-10-02T09-00-00Z"},
+		{"2025-10-02T08:00:00Z", "2025-10-01T09-00-00Z"},
+		{"2026-01-01", "2025-10-03T09-00-00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			entry, err := store.Resolve(tt.ref)
+			if err != nil {
+				t.Fatalf("Resolve(%q) failed: %v", tt.ref, err)
+			}
+			if entry.ID != tt.wantID {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.ref, entry.ID, tt.wantID)
+			}
+		})
+	}
+
+	for _, ref := range []string{"latest~3", "latest~x", "2025-09-30", "nonsense"} {
+		if _, err := store.Resolve(ref); err == nil {
+			t.Errorf("Resolve(%q) should fail", ref)
+		}
+	}
+}
+
+func TestStore_ResolveEmpty(t *testing.T) {
+	store, err := CreateStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("CreateStore failed: %v", err)
+	}
+	_, err = store.Resolve("latest")
+	if err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected empty store error, got %v", err)
+	}
+}
+
+func TestSelectRetained(t *testing.T) {
+	now := time.Date(2025, 10, 15, 12, 0, 0, 0, time.UTC)
+	entries := []StoreEntry{
+		{ID: "jul", CapturedAt: "2025-07-20T09:00:00Z"},
+		{ID: "aug-early", CapturedAt: "2025-08-01T09:00:00Z"},
+		{ID: "aug-late", CapturedAt: "2025-08-30T09:00:00Z"},
+		{ID: "oct12", CapturedAt: "2025-10-12T09:00:00Z"},
+		{ID: "oct14-am", CapturedAt: "2025-10-14T09:00:00Z"},
+		{ID: "oct14-pm", CapturedAt: "2025-10-14T18:00:00Z"},
+		{ID: "oct15", CapturedAt: "2025-10-15T09:00:00Z"},
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "keep last",
+			policy: RetentionPolicy{KeepLast: 2},
+			want:   []string{"oct14-pm", "oct15"},
+		},
+		{
+			name:   "keep daily within window",
+			policy: RetentionPolicy{KeepDaily: 2},
+			want:   []string{"oct14-pm", "oct15"},
+		},
+		{
+			name:   "keep daily wider window",
+			policy: RetentionPolicy{KeepDaily: 7},
+			want:   []string{"oct12", "oct14-pm", "oct15"},
+		},
+		{
+			name:   "keep monthly",
+			policy: RetentionPolicy{KeepMonthly: 3},
+			want:   []string{"aug-late", "oct15"},
+		},
+		{
+			name:   "combined",
+			policy: RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepMonthly: 4},
+			want:   []string{"jul", "aug-late", "oct14-pm", "oct15"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep := selectRetained(entries, tt.policy, now)
+			if len(keep) != len(tt.want) {
+				t.Errorf("kept %v, want %v", keep, tt.want)
+			}
+			for _, id := range tt.want {
+				if !keep[id] {
+					t.Errorf("%s should be kept", id)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	dir := t.TempDir()
+	store, err := CreateStore(dir)
+	if err != nil {
+		t.Fatalf("CreateStore failed: %v", err)
+	}
+	for _, ts := range []string{"2025-10-01T09:00:00Z", "2025-10-02T09:00:00Z", "2025-10-03T09:00:00Z"} {
+		store.Add(testSnapshot(ts, 10))
+	}
+	oldest := store.Entries()[0]
+
+	now := time.Date(2025, 10, 3, 12, 0, 0, 0, time.UTC)
+
+	removed, err := store.Prune(RetentionPolicy{KeepLast: 2}, now, true)
+	if err != nil {
+		t.Fatalf("dry-run Prune failed: %v", err)
+	}
+	if len(removed) != 1 || len(store.Entries()) != 3 {
+		t.Fatalf("dry run should report 1 removal and keep all entries, got %d removed, %d entries", len(removed), len(store.Entries()))
+	}
+
+	removed, err = store.Prune(RetentionPolicy{KeepLast: 2}, now, false)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0].ID != oldest.ID {
+		t.Fatalf("removed = %v, want %s", removed, oldest.ID)
+	}
+	if _, err := os.Stat(store.Path(oldest)); !os.IsNotExist(err) {
+		t.Error("pruned snapshot file should be deleted")
+	}
+
+	reopened, _ := OpenStore(dir)
+	if len(reopened.Entries()) != 2 {
+		t.Errorf("index should hold 2 entries after prune, got %d", len(reopened.Entries()))
+	}
+
+	if _, err := store.Prune(RetentionPolicy{}, now, false); err == nil {
+		t.Error("Prune with an empty policy should fail")
+	}
+}
+
+func TestLoadSnapshotRef(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := CreateStore(dir)
+	store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+	store.Add(testSnapshot("2025-10-02T09:00:00Z", 5))
+
+	config, _, src, err := LoadSnapshotRef(context.Background(), "latest~1", SnapshotSources{StoreDir: dir})
+	if err != nil {
+		t.Fatalf("LoadSnapshotRef failed: %v", err)
+	}
+	if src.File != "mm-config-snapshot-2025-10-01T09-00-00Z.json" || src.Source != "store" {
+		t.Errorf("source = %+v", src)
+	}
+	svc := config["ServiceSettings"].(map[string]interface{})
+	if svc["MaximumLoginAttempts"] != float64(10) {
+		t.Errorf("loaded wrong snapshot: %v", svc["MaximumLoginAttempts"])
+	}
+
+	// Existing files take precedence over store references.
+	_, meta, src, err := LoadSnapshotRef(context.Background(), filepath.Join("testdata", "valid-snapshot.json"), SnapshotSources{StoreDir: dir})
+	if err != nil {
+		t.Fatalf("LoadSnapshotRef(context.Background(), file) failed: %v", err)
+	}
+	if src.File != "valid-snapshot.json" || src.Source != "file" || meta.CapturedAt != "2025-10-01T09:00:00Z" {
+		t.Errorf("unexpected file load: %+v", src)
+	}
+
+	// Without a store, references are plain paths.
+	if _, _, _, err := LoadSnapshotRef(context.Background(), "latest", SnapshotSources{}); err == nil {
+		t.Error("expected error resolving latest without a store")
+	}
+}
+
+func TestContentHash_IgnoresMetadata(t *testing.T) {
+	a, err := ContentHash(testSnapshot("2025-10-01T09:00:00Z", 10))
+	if err != nil {
+		t.Fatalf("ContentHash failed: %v", err)
+	}
+	b, _ := ContentHash(testSnapshot("2025-10-02T09:00:00Z", 10))
+	c, _ := ContentHash(testSnapshot("2025-10-02T09:00:00Z", 5))
+	if a != b {
+		t.Error("snapshots differing only in metadata should hash equally")
+	}
+	if a == c {
+		t.Error("snapshots with different content should hash differently")
+	}
+}
+
+func TestLoadSnapshotRef_DedupName(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := InitStore(dir, true)
+	store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+
+	_, _, src, err := LoadSnapshotRef(context.Background(), "latest", SnapshotSources{StoreDir: dir})
+	if err != nil {
+		t.Fatalf("LoadSnapshotRef failed: %v", err)
+	}
+	if src.File != "mm-config-snapshot-2025-10-01T09-00-00Z.json" {
+		t.Errorf("File = %q, want the snapshot's name rather than its content object", src.File)
+	}
+}
+
+func TestLoadSnapshotRef_ScopedToServer(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := CreateStore(dir)
+	store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+	other := testSnapshot("2025-10-02T09:00:00Z", 5)
+	other["_metadata"].(map[string]interface{})["server_url"] = "https://other.example.com"
+	store.Add(other)
+
+	tests := []struct {
+		ref, server string
+		want        float64
+	}{
+		{"latest", "", 5},
+		{"latest", "https://mm.example.com/", 10},
+		{"latest", "https://other.example.com", 5},
+		{"2025-10-03", "https://mm.example.com", 10},
+	}
+	for _, tt := range tests {
+		config, _, _, err := LoadSnapshotRef(context.Background(), tt.ref, SnapshotSources{StoreDir: dir, ServerURL: tt.server})
+		if err != nil {
+			t.Fatalf("LoadSnapshotRef(%q, %q) failed: %v", tt.ref, tt.server, err)
+		}
+		if got := config["ServiceSettings"].(map[string]interface{})["MaximumLoginAttempts"]; got != tt.want {
+			t.Errorf("LoadSnapshotRef(%q, %q) loaded %v, want %v", tt.ref, tt.server, got, tt.want)
+		}
+	}
+
+	if _, _, _, err := LoadSnapshotRef(context.Background(), "latest~1", SnapshotSources{StoreDir: dir, ServerURL: "https://mm.example.com"}); err == nil {
+		t.Error("latest~1 should count only the server's snapshots")
+	}
+	if _, _, _, err := LoadSnapshotRef(context.Background(), "latest", SnapshotSources{StoreDir: dir, ServerURL: "https://new.example.com"}); err == nil {
+		t.Error("expected an error for a server with no snapshots")
+	}
+	// An entry ID names one snapshot whatever the server.
+	if _, _, _, err := LoadSnapshotRef(context.Background(), "2025-10-02T09-00-00Z", SnapshotSources{StoreDir: dir, ServerURL: "https://mm.example.com"}); err != nil {
+		t.Errorf("ID reference failed: %v", err)
+	}
+}
+
+func TestStore_Dedup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := InitStore(dir, true)
+	if err != nil {
+		t.Fatalf("InitStore failed: %v", err)
+	}
+
+	first, _ := store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+	second, _ := store.Add(testSnapshot("2025-10-02T09:00:00Z", 10))
+	third, err := store.Add(testSnapshot("2025-10-03T09:00:00Z", 5))
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if first.File != second.File {
+		t.Errorf("identical content should share an object: %s vs %s", first.File, second.File)
+	}
+	if first.File == third.File {
+		t.Error("different content should not share an object")
+	}
+	objects, _ := filepath.Glob(filepath.Join(dir, storeObjectsDir, "*", "*.json"))
+	if len(objects) != 2 {
+		t.Errorf("expected 2 objects, got %d", len(objects))
+	}
+
+	// Each pointer keeps its own metadata.
+	reopened, _ := OpenStore(dir)
+	if !reopened.Dedup() {
+		t.Error("dedup mode should persist")
+	}
+	_, meta, err := reopened.Load(reopened.Entries()[1])
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if meta.CapturedAt != "2025-10-02T09:00:00Z" {
+		t.Errorf("CapturedAt = %q", meta.CapturedAt)
+	}
+
+	// Changing the mode of a populated store is refused.
+	if _, err := InitStore(dir, false); err == nil {
+		t.Error("expected error changing the mode of a populated store")
+	}
+}
+
+func TestStore_DedupPruneKeepsSharedObjects(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := InitStore(dir, true)
+	first, _ := store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+	store.Add(testSnapshot("2025-10-02T09:00:00Z", 10))
+
+	now := time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)
+	if _, err := store.Prune(RetentionPolicy{KeepLast: 1}, now, false); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if _, err := os.Stat(store.Path(*first)); err != nil {
+		t.Error("object still referenced by a kept entry should not be deleted")
+	}
+}
+
+func TestStore_UnchangedSince(t *testing.T) {
+	for _, dedup := range []bool{false, true} {
+		store, _ := InitStore(t.TempDir(), dedup)
+		store.Add(testSnapshot("2025-10-01T09:00:00Z", 10))
+		store.Add(testSnapshot("2025-10-02T09:00:00Z", 5))
+		store.Add(testSnapshot("2025-10-03T09:00:00Z", 5))
+
+		unchanged, since, _, err := store.UnchangedSince("latest~1")
+		if err != nil {
+			t.Fatalf("UnchangedSince failed: %v", err)
+		}
+		if !unchanged || since.ID != "2025-10-02T09-00-00Z" {
+			t.Errorf("dedup=%v: expected no change since latest~1, got unchanged=%v since=%s", dedup, unchanged, since.ID)
+		}
+
+		unchanged, _, changedAt, err := store.UnchangedSince("2025-10-01")
+		if err != nil {
+			t.Fatalf("UnchangedSince failed: %v", err)
+		}
+		if unchanged || changedAt == nil || changedAt.ID != "2025-10-02T09-00-00Z" {
+			t.Errorf("dedup=%v: expected change first seen in 2025-10-02, got unchanged=%v changedAt=%v", dedup, unchanged, changedAt)
+		}
+	}
+}
+
+func TestOpenStore_NotFound(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "typo")
+	_, err := OpenStore(dir)
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+		t.Errorf("error = %v, want ExitConfigError", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("opening a store should not create its directory")
+	}
+
+	// References are resolved without creating the store either.
+	_, _, _, err = LoadSnapshotRef(context.Background(), "latest", SnapshotSources{StoreDir: dir})
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+		t.Errorf("LoadSnapshotRef error = %v, want ExitConfigError", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("resolving a reference should not create the store directory")
+	}
+
+	// An existing directory that holds no index is not a store.
+	if _, err := OpenStore(t.TempDir()); err == nil {
+		t.Error("a directory without an index should not open as a store")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SummaryCounts counts drifted fields by change type.
+type SummaryCounts struct {
+	Changed int `json:"changed"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Total   int `json:"total"`
+}
+
+func (c *SummaryCounts) add(changeType string) {
+	switch changeType {
+	case "changed":
+		c.Changed++
+	case "added":
+		c.Added++
+	case "removed":
+		c.Removed++
+	}
+	c.Total++
+}
+
+// SummaryGroup counts the drifted fields under one path.
+type SummaryGroup struct {
+	Path string `json:"path"`
+	SummaryCounts
+}
+
+// DiffSummary is a diff result collapsed to counts per section, or per
+// path of a given depth.
+type DiffSummary struct {
+	Baseline      DiffSource     `json:"baseline"`
+	Compared      DiffSource     `json:"compared"`
+	DriftDetected bool           `json:"drift_detected"`
+	Depth         int            `json:"depth"`
+	Groups        []SummaryGroup `json:"groups"`
+	Total         SummaryCounts  `json:"total"`
+	NotVisible    int            `json:"not_visible,omitempty"`
+}
+
+// SummarizeDiff groups the drifted fields of a diff result by their first
+// depth path segments; depth 1 groups by top-level section.
+func SummarizeDiff(result *DiffResult, depth int) *DiffSummary {
+	summary := &DiffSummary{
+		Baseline:      result.Baseline,
+		Compared:      result.Compared,
+		DriftDetected: result.DriftDetected,
+		Depth:         depth,
+		Groups:        []SummaryGroup{},
+		NotVisible:    len(result.NotVisible),
+	}
+	// Entries are in field order, so the fields of a group are adjacent.
+	for _, e := range result.Entries() {
+		path := collapsePath(e.Field, depth)
+		if n := len(summary.Groups); n == 0 || summary.Groups[n-1].Path != path {
+			summary.Groups = append(summary.Groups, SummaryGroup{Path: path})
+		}
+		summary.Groups[len(summary.Groups)-1].add(e.ChangeType)
+		summary.Total.add(e.ChangeType)
+	}
+	return summary
+}
+
+// collapsePath returns the first depth segments of a dot-notation path.
+func collapsePath(field string, depth int) string {
+	parts := strings.SplitN(field, ".", depth+1)
+	if len(parts) <= depth {
+		return field
+	}
+	return strings.Join(parts[:depth], ".")
+}
+
+// FormatSummaryText produces a table of drift counts per group.
+func FormatSummaryText(summary *DiffSummary) string {
+	var sb strings.Builder
+	if !summary.DriftDetected {
+		sb.WriteString("No configuration drift detected.\n")
+		if summary.NotVisible > 0 {
+			sb.WriteString(fmt.Sprintf("%d field(s) were not compared because one capture could not read them.\n", summary.NotVisible))
+		}
+		return sb.String()
+	}
+
+	sb.WriteString("Configuration drift summary between:\n")
+	sb.WriteString(fmt.Sprintf("  Baseline : %s\n", formatSource(summary.Baseline)))
+	sb.WriteString(fmt.Sprintf("  Compared : %s\n\n", formatSource(summary.Compared)))
+
+	heading := "SECTION"
+	if summary.Depth > 1 {
+		heading = "PATH"
+	}
+	width := len(heading)
+	for _, g := range summary.Groups {
+		width = max(width, len(g.Path))
+	}
+	row := func(path string, c SummaryCounts) {
+		sb.WriteString(fmt.Sprintf("%-*s  %7d  %5d  %7d  %5d\n", width, path, c.Changed, c.Added, c.Removed, c.Total))
+	}
+	sb.WriteString(fmt.Sprintf("%-*s  %7s  %5s  %7s  %5s\n", width, heading, "CHANGED", "ADDED", "REMOVED", "TOTAL"))
+	for _, g := range summary.Groups {
+		row(g.Path, g.SummaryCounts)
+	}
+	row("TOTAL", summary.Total)
+
+	if summary.NotVisible > 0 {
+		sb.WriteString(fmt.Sprintf("\n%d field(s) were not compared because one capture could not read them.\n", summary.NotVisible))
+	}
+	return sb.String()
+}
+
+// FormatSummaryJSON produces JSON output for a diff summary.
+func FormatSummaryJSON(summary *DiffSummary) (string, error) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to marshal diff summary to JSON", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeDiff(t *testing.T) {
+	result := sampleDiffResult()
+	result.Added = append(result.Added, AddedField{Field: "PluginSettings.Plugins.playbooks.enabled", Value: true})
+
+	summary := SummarizeDiff(result, 1)
+	want := []SummaryGroup{
+		{Path: "PluginSettings", SummaryCounts: SummaryCounts{Added: 2, Total: 2}},
+		{Path: "ServiceSettings", SummaryCounts: SummaryCounts{Changed: 2, Total: 2}},
+		{Path: "TeamSettings", SummaryCounts: SummaryCounts{Removed: 1, Total: 1}},
+	}
+	if !reflect.DeepEqual(summary.Groups, want) {
+		t.Errorf("groups = %+v, want %+v", summary.Groups, want)
+	}
+	if summary.Total != (SummaryCounts{Changed: 2, Added: 2, Removed: 1, Total: 5}) {
+		t.Errorf("total = %+v", summary.Total)
+	}
+
+	summary = SummarizeDiff(result, 2)
+	var paths []string
+	for _, g := range summary.Groups {
+		paths = append(paths, g.Path)
+	}
+	if got := strings.Join(paths, ","); got != "PluginSettings.PluginStates,PluginSettings.Plugins,ServiceSettings.AllowCorsFrom,ServiceSettings.MaximumLoginAttempts,TeamSettings.ExperimentalDefaultChannels" {
+		t.Errorf("depth 2 paths = %s", got)
+	}
+}
+
+func TestCollapsePath(t *testing.T) {
+	tests := []struct {
+		field string
+		depth int
+		want  string
+	}{
+		{"ServiceSettings.SiteURL", 1, "ServiceSettings"},
+		{"ServiceSettings.SiteURL", 2, "ServiceSettings.SiteURL"},
+		{"ServiceSettings.SiteURL", 5, "ServiceSettings.SiteURL"},
+		{"PluginSettings.Plugins.playbooks.enabled", 3, "PluginSettings.Plugins.playbooks"},
+		{"Top", 1, "Top"},
+	}
+	for _, tt := range tests {
+		if got := collapsePath(tt.field, tt.depth); got != tt.want {
+			t.Errorf("collapsePath(%q, %d) = %q, want %q", tt.field, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSummaryText(t *testing.T) {
+	out := FormatSummaryText(SummarizeDiff(sampleDiffResult(), 1))
+	for _, want := range []string{
+		"Configuration drift summary between:",
+		"SECTION          CHANGED  ADDED  REMOVED  TOTAL\n",
+		"PluginSettings         0      1        0      1\n",
+		"ServiceSettings        2      0        0      2\n",
+		"TOTAL                  2      1        1      4\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	if out := FormatSummaryText(SummarizeDiff(sampleDiffResult(), 2)); !strings.Contains(out, "PATH ") {
+		t.Errorf("deeper summaries should head the column PATH:\n%s", out)
+	}
+
+	noDrift := SummarizeDiff(&DiffResult{NotVisible: []NotVisibleField{{Field: "SqlSettings.DriverName"}}}, 1)
+	if out := FormatSummaryText(noDrift); out != "No configuration drift detected.\n1 field(s) were not compared because one capture could not read them.\n" {
+		t.Errorf("no drift output = %q", out)
+	}
+}
+
+func TestFormatSummaryJSON(t *testing.T) {
+	out, err := FormatSummaryJSON(SummarizeDiff(sampleDiffResult(), 1))
+	if err != nil {
+		t.Fatalf("FormatSummaryJSON() error: %v", err)
+	}
+	var parsed struct {
+		DriftDetected bool `json:"drift_detected"`
+		Depth         int  `json:"depth"`
+		Groups        []struct {
+			Path    string `json:"path"`
+			Changed int    `json:"changed"`
+			Total   int    `json:"total"`
+		} `json:"groups"`
+		Total struct {
+			Total int `json:"total"`
+		} `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if !parsed.DriftDetected || parsed.Depth != 1 || len(parsed.Groups) != 3 || parsed.Total.Total != 4 {
+		t.Errorf("parsed = %+v", parsed)
+	}
+	if g := parsed.Groups[1]; g.Path != "ServiceSettings" || g.Changed != 2 || g.Total != 2 {
+		t.Errorf("ServiceSettings group = %+v", g)
+	}
+
+	empty, _ := FormatSummaryJSON(SummarizeDiff(&DiffResult{}, 1))
+	if !strings.Contains(empty, `"groups": []`) {
+		t.Errorf("groups should be an empty array:\n%s", empty)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogFacility    = 16 // local0
+	syslogAppName     = "mm-config-diff"
+	syslogMsgID       = "config-drift"
+	maxSyslogFrame    = 1 << 20
+	maxSyslogDatagram = 65507 // the largest UDP payload over IPv4
+	syslogTimestamp   = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogSeverity maps a field severity onto a syslog severity: warning,
+// notice or informational.
+var syslogSeverity = map[string]int{"high": 4, "medium": 5, "low": 6}
+
+// defaultSyslogPorts are used when a syslog URL has no port.
+var defaultSyslogPorts = map[string]string{"udp": "514", "tcp": "514", "tls": "6514"}
+
+// parseSyslogURL splits a udp://, tcp:// or tls:// URL into its scheme and
+// host:port address.
+func parseSyslogURL(raw string) (scheme, addr string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || defaultSyslogPorts[u.Scheme] == "" {
+		return "", "", NewExitError(ExitConfigError, fmt.Sprintf("error: invalid syslog address %q. Use udp://, tcp:// or tls://host:port.", raw), err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultSyslogPorts[u.Scheme]
+	}
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// SyslogWriter sends RFC 5424 messages to a syslog server. Over TCP and TLS
+// messages are framed by octet counting (RFC 6587, RFC 5425); over UDP
+// each message is one datagram.
+type SyslogWriter struct {
+	conn     net.Conn
+	framed   bool
+	hostname string
+	timeout  time.Duration
+}
+
+// DialSyslog connects to the syslog server at a udp://, tcp:// or tls://
+// URL. The TLS options apply to tls:// only. timeout bounds the connection
+// and each write; 0 disables it.
+func DialSyslog(ctx context.Context, rawURL string, tlsOpts TLSOptions, timeout time.Duration) (*SyslogWriter, error) {
+	scheme, addr, err := parseSyslogURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch scheme {
+	case "tls":
+		tlsConfig, tlsErr := newTLSConfig(tlsOpts)
+		if tlsErr != nil {
+			return nil, tlsErr
+		}
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	default:
+		conn, err = dialer.DialContext(ctx, scheme, addr)
+	}
+	if err != nil {
+		return nil, NewExitError(ExitOutputError, fmt.Sprintf("error: unable to connect to syslog server %s", rawURL), err)
+	}
+
+	return &SyslogWriter{conn: conn, framed: scheme != "udp", hostname: syslogHostname(), timeout: timeout}, nil
+}
+
+func syslogHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "-"
+	}
+	return hostname
+}
+
+// Send writes one message with the given syslog severity. The write gives
+// up at the writer's timeout or the context's deadline, whichever is
+// sooner.
+func (w *SyslogWriter) Send(ctx context.Context, severity int, ts time.Time, msg string) error {
+	line := formatSyslogMessage(severity, ts, w.hostname, msg)
+	if w.framed {
+		line = strconv.Itoa(len(line)) + " " + line
+	} else if len(line) > maxSyslogDatagram {
+		return fmt.Errorf("message of %d bytes exceeds the %d-byte UDP limit", len(line), maxSyslogDatagram)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var deadline time.Time
+	if w.timeout > 0 {
+		deadline = time.Now().Add(w.timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	if err := w.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w.conn, line)
+	return err
+}
+
+// Close closes the connection to the syslog server.
+func (w *SyslogWriter) Close() error {
+	return w.conn.Close()
+}
+
+// formatSyslogMessage formats an RFC 5424 message without structured data.
+func formatSyslogMessage(severity int, ts time.Time, hostname, msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacility*8+severity, ts.UTC().Format(syslogTimestamp), hostname, syslogAppName, os.Getpid(), syslogMsgID, msg)
+}
+
+// SendDriftEvents sends each event to a syslog server, as a CEF line when
+// cef is set and as a JSON object otherwise.
+func SendDriftEvents(ctx context.Context, w *SyslogWriter, events []DriftEvent, cef bool, toolVersion string) error {
+	for _, event := range events {
+		msg, err := driftEventMessage(event, cef, toolVersion)
+		if err != nil {
+			return err
+		}
+		if err := w.Send(ctx, syslogSeverity[event.Severity], eventTime(event), msg); err != nil {
+			return NewExitError(ExitOutputError, "error: unable to send drift event to syslog", err)
+		}
+	}
+	return nil
+}
+
+// CheckSyslogEvents reports an error if any event is too large to send to
+// a udp:// syslog server, so that the run can fail before it writes a
+// report. TCP and TLS have no practical limit.
+func CheckSyslogEvents(rawURL string, events []DriftEvent, cef bool, toolVersion string) error {
+	scheme, _, err := parseSyslogURL(rawURL)
+	if err != nil || scheme != "udp" {
+		return err
+	}
+	hostname := syslogHostname()
+	for _, event := range events {
+		msg, err := driftEventMessage(event, cef, toolVersion)
+		if err != nil {
+			return err
+		}
+		if n := len(formatSyslogMessage(syslogSeverity[event.Severity], eventTime(event), hostname, msg)); n > maxSyslogDatagram {
+			return NewExitError(ExitConfigError, fmt.Sprintf("error: the drift event for %s is %d bytes, more than a UDP syslog message can carry (%d bytes). Use a tcp:// or tls:// syslog server.", event.Path, n, maxSyslogDatagram), nil)
+		}
+	}
+	return nil
+}
+
+// driftEventMessage returns the syslog message body for an event.
+func driftEventMessage(event DriftEvent, cef bool, toolVersion string) (string, error) {
+	if cef {
+		return formatCEFEvent(event, toolVersion), nil
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to marshal drift event to JSON", err)
+	}
+	return string(data), nil
+}
+
+func eventTime(event DriftEvent) time.Time {
+	ts, err := time.Parse(time.RFC3339, event.Timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return ts
+}
+
+// SyslogListener receives syslog messages on a local address, for testing
+// delivery without a SIEM.
+type SyslogListener struct {
+	packet   net.PacketConn
+	listener net.Listener
+}
+
+// ListenSyslog listens on a udp://, tcp:// or tls:// URL. tlsConfig is
+// required for tls://.
+func ListenSyslog(rawURL string, tlsConfig *tls.Config) (*SyslogListener, error) {
+	scheme, addr, err := parseSyslogURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &SyslogListener{}
+	switch scheme {
+	case "udp":
+		l.packet, err = net.ListenPacket("udp", addr)
+	case "tcp":
+		l.listener, err = net.Listen("tcp", addr)
+	case "tls":
+		if tlsConfig == nil {
+			return nil, NewExitError(ExitConfigError, "error: a tls:// listener requires --tls-cert and --tls-key.", nil)
+		}
+		l.listener, err = tls.Listen("tcp", addr, tlsConfig)
+	}
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to listen on %s", rawURL), err)
+	}
+	return l, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *SyslogListener) Addr() string {
+	if l.packet != nil {
+		return l.packet.LocalAddr().String()
+	}
+	return l.listener.Addr().String()
+}
+
+// Serve calls handle with each message received, one at a time, until the
+// listener is closed.
+func (l *SyslogListener) Serve(handle func(msg string)) error {
+	var mu sync.Mutex
+	deliver := func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		handle(msg)
+	}
+
+	if l.packet != nil {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := l.packet.ReadFrom(buf)
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			deliver(strings.TrimRight(string(buf[:n]), "\n"))
+		}
+	}
+
+	for {
+		conn, err := l.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := readSyslogFrames(bufio.NewReader(conn), deliver); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: dropped connection from %s: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Close stops the listener.
+func (l *SyslogListener) Close() error {
+	if l.packet != nil {
+		return l.packet.Close()
+	}
+	return l.listener.Close()
+}
+
+// readSyslogFrames reads octet-counted or newline-delimited messages from
+// a stream until it ends.
+func readSyslogFrames(r *bufio.Reader, handle func(string)) error {
+	for {
+		b, err := r.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if b[0] < '0' || b[0] > '9' {
+			line, err := r.ReadString('\n')
+			if line = strings.TrimRight(line, "\r\n"); line != "" {
+				handle(line)
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return fmt.Errorf("incomplete frame length: %w", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil || n > maxSyslogFrame {
+			return fmt.Errorf("invalid frame length %q", strings.TrimSuffix(prefix, " "))
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return fmt.Errorf("incomplete frame: %w", err)
+		}
+		handle(string(msg))
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSyslogListener listens on a local port and returns its URL and a
+// channel of the messages received.
+func startSyslogListener(t *testing.T, scheme string, tlsConfig *tls.Config) (string, <-chan string) {
+	t.Helper()
+	listener, err := ListenSyslog(scheme+"://127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("ListenSyslog() error: %v", err)
+	}
+	messages := make(chan string, 10)
+	go listener.Serve(func(msg string) { messages <- msg })
+	t.Cleanup(func() { listener.Close() })
+	return scheme + "://" + listener.Addr(), messages
+}
+
+func receive(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a syslog message")
+		return ""
+	}
+}
+
+func TestSendDriftEvents(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "syslog", x509.ExtKeyUsageServerAuth)
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := writeTestFile(t, t.TempDir(), "ca.pem", ca.pem)
+
+	header := regexp.MustCompile(`^<132>1 2025-10-01T10:00:00\.000000Z \S+ mm-config-diff \d+ config-drift - `)
+	events := NewDriftEvents(sampleDiffResult(), "https://mm.example.com", "run-1", time.Date(2025, 10, 1, 10, 0, 0, 0, time.UTC))
+
+	for _, scheme := range []string{"udp", "tcp", "tls"} {
+		t.Run(scheme, func(t *testing.T) {
+			addr, messages := startSyslogListener(t, scheme, &tls.Config{Certificates: []tls.Certificate{pair}})
+			w, err := DialSyslog(context.Background(), addr, TLSOptions{CAFile: caFile}, DefaultTimeout)
+			if err != nil {
+				t.Fatalf("DialSyslog() error: %v", err)
+			}
+			defer w.Close()
+
+			if err := SendDriftEvents(context.Background(), w, events, false, "dev"); err != nil {
+				t.Fatalf("SendDriftEvents() error: %v", err)
+			}
+			var got []string
+			for range events {
+				got = append(got, receive(t, messages))
+			}
+			// ServiceSettings.AllowCorsFrom is high severity: local0.warning.
+			if !header.MatchString(got[1]) || !strings.HasSuffix(got[1], `"path":"ServiceSettings.AllowCorsFrom","section":"ServiceSettings","change_type":"changed","severity":"high","before":"","after":"a|b","baseline":"`+events[1].Baseline+`","compared":"`+events[1].Compared+`"}`) {
+				t.Errorf("message = %s", got[1])
+			}
+		})
+	}
+
+	t.Run("cef", func(t *testing.T) {
+		addr, messages := startSyslogListener(t, "tcp", nil)
+		w, err := DialSyslog(context.Background(), addr, TLSOptions{}, DefaultTimeout)
+		if err != nil {
+			t.Fatalf("DialSyslog() error: %v", err)
+		}
+		defer w.Close()
+		if err := SendDriftEvents(context.Background(), w, events[:1], true, "dev"); err != nil {
+			t.Fatalf("SendDriftEvents() error: %v", err)
+		}
+		if msg := receive(t, messages); !strings.Contains(msg, " config-drift - CEF:0|Mattermost|mm-config-diff|dev|config-added|") {
+			t.Errorf("message = %s", msg)
+		}
+	})
+}
+
+func TestSyslogWriter_WriteTimeout(t *testing.T) {
+	// A server that accepts the connection but never reads from it.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	w, err := DialSyslog(context.Background(), "tcp://"+listener.Addr().String(), TLSOptions{}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("DialSyslog() error: %v", err)
+	}
+	defer w.Close()
+
+	msg := strings.Repeat("x", 1<<20)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err = w.Send(context.Background(), 6, time.Now(), msg); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatal("expected a write to time out once the server stopped reading")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("write took %v to time out", elapsed)
+	}
+}
+
+func TestCheckSyslogEvents(t *testing.T) {
+	result := &DiffResult{Changed: []ChangedField{{Field: "TeamSettings.CustomDescriptionText", Before: "", After: strings.Repeat("x", maxSyslogDatagram)}}}
+	events := NewDriftEvents(result, "https://mm.example.com", "run-1", time.Now())
+
+	err := CheckSyslogEvents("udp://127.0.0.1:514", events, false, "dev")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitConfigError || !strings.Contains(exitErr.Message, "TeamSettings.CustomDescriptionText") {
+		t.Errorf("udp: error = %v, want ExitConfigError naming the field", err)
+	}
+	if err := CheckSyslogEvents("tcp://127.0.0.1:514", events, false, "dev"); err != nil {
+		t.Errorf("tcp: error = %v, want none", err)
+	}
+	if err := CheckSyslogEvents("udp://127.0.0.1:514", NewDriftEvents(sampleDiffResult(), "https://mm.example.com", "run-1", time.Now()), true, "dev"); err != nil {
+		t.Errorf("udp with small events: error = %v, want none", err)
+	}
+}
+
+func TestDialSyslog_Errors(t *testing.T) {
+	for _, raw := range []string{"syslog.example.com:514", "http://syslog.example.com", "udp://"} {
+		_, err := DialSyslog(context.Background(), raw, TLSOptions{}, DefaultTimeout)
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Code != ExitConfigError {
+			t.Errorf("%q: error = %v, want ExitConfigError", raw, err)
+		}
+	}
+
+	// A server with an untrusted certificate is rejected.
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "syslog", x509.ExtKeyUsageServerAuth)
+	pair, _ := tls.X509KeyPair(certPEM, keyPEM)
+	addr, _ := startSyslogListener(t, "tls", &tls.Config{Certificates: []tls.Certificate{pair}})
+	_, err := DialSyslog(context.Background(), addr, TLSOptions{}, DefaultTimeout)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitOutputError {
+		t.Errorf("untrusted certificate: error = %v, want ExitOutputError", err)
+	}
+
+	if _, err := ListenSyslog("tls://127.0.0.1:0", nil); err == nil {
+		t.Error("a tls:// listener without a certificate should fail")
+	}
+}
+
+func TestParseSyslogURL(t *testing.T) {
+	tests := []struct {
+		raw, scheme, addr string
+	}{
+		{"udp://syslog.example.com", "udp", "syslog.example.com:514"},
+		{"tcp://syslog.example.com:1514", "tcp", "syslog.example.com:1514"},
+		{"tls://[::1]", "tls", "[::1]:6514"},
+	}
+	for _, tt := range tests {
+		scheme, addr, err := parseSyslogURL(tt.raw)
+		if err != nil || scheme != tt.scheme || addr != tt.addr {
+			t.Errorf("parseSyslogURL(%q) = %q, %q, %v", tt.raw, scheme, addr, err)
+		}
+	}
+}
+
+func TestReadSyslogFrames(t *testing.T) {
+	input := "5 hello<13>1 plain line\r\n10 two\nlines\n"
+	var got []string
+	if err := readSyslogFrames(bufio.NewReader(strings.NewReader(input)), func(msg string) { got = append(got, msg) }); err != nil {
+		t.Fatalf("readSyslogFrames() error: %v", err)
+	}
+	want := []string{"hello", "<13>1 plain line", "two\nlines\n"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"5 hi", "99999999 x", "12x"} {
+		if err := readSyslogFrames(bufio.NewReader(strings.NewReader(bad)), func(string) {}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// bundledTemplates are example report templates that --template accepts by
+// name, e.g. --template mattermost.
+//
+//go:embed templates/*
+var bundledTemplates embed.FS
+
+// TemplateData is what a --template report is executed against. The diff
+// result's fields, such as .Changed and .DriftDetected, are promoted.
+type TemplateData struct {
+	*DiffResult
+
+	// Entries are the changed, added and removed fields in field order, and
+	// Sections the same grouped by config section.
+	Entries  []DiffEntry
+	Sections []SectionEntries
+
+	BaselineMeta *SnapshotMetadata
+	ComparedMeta *SnapshotMetadata
+	GeneratedAt  string
+}
+
+// NewTemplateData prepares a diff result and the metadata of the compared
+// snapshots for a report template.
+func NewTemplateData(result *DiffResult, baseline, compared *SnapshotMetadata) TemplateData {
+	entries := result.Entries()
+	return TemplateData{
+		DiffResult:   result,
+		Entries:      entries,
+		Sections:     GroupBySection(entries),
+		BaselineMeta: baseline,
+		ComparedMeta: compared,
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// templateFuncs are the helper functions available in report templates.
+var templateFuncs = map[string]interface{}{
+	"formatValue": FormatValue,
+	"section":     configSection,
+	"severity":    FieldSeverity,
+	"json":        templateJSON,
+	"truncate":    truncate,
+}
+
+func templateJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// truncate shortens s to at most n characters, ending with an ellipsis if
+// it was cut. Its argument order suits pipelines: {{.Field | truncate 20}}.
+func truncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// ReportTemplate is a parsed text/template or html/template.
+type ReportTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// LoadReportTemplate parses the template file at path, or the bundled
+// template of that name if there is no such file. Files ending in .html or
+// .htm are parsed with html/template, which escapes values for HTML; others
+// with text/template.
+func LoadReportTemplate(path string) (ReportTemplate, error) {
+	name := filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if bundled, ok := bundledTemplate(path); ok {
+			name = bundled
+			data, err = bundledTemplates.ReadFile("templates/" + bundled)
+		}
+	}
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read template %s. Bundled templates: %s.", path, strings.Join(BundledTemplateNames(), ", ")), err)
+	}
+
+	var tmpl ReportTemplate
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm":
+		tmpl, err = htmltemplate.New(name).Funcs(templateFuncs).Parse(string(data))
+	default:
+		tmpl, err = template.New(name).Funcs(templateFuncs).Parse(string(data))
+	}
+	if err != nil {
+		return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: template %s is not valid", path), err)
+	}
+	return tmpl, nil
+}
+
+func templateContentType(tmpl ReportTemplate) string {
+	if _, ok := tmpl.(*htmltemplate.Template); ok {
+		return "text/html; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// BundledTemplateNames lists the bundled templates.
+func BundledTemplateNames() []string {
+	entries, _ := bundledTemplates.ReadDir("templates")
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bundledTemplate returns the file name of the bundled template that name
+// refers to, with or without its extension.
+func bundledTemplate(name string) (string, bool) {
+	for _, file := range BundledTemplateNames() {
+		if name == file || name == strings.TrimSuffix(file, filepath.Ext(file)) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// FormatDiffTemplate executes a report template against a diff result.
+func FormatDiffTemplate(tmpl ReportTemplate, data TemplateData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", NewExitError(ExitOutputError, "error: failed to execute template", err)
+	}
+	return sb.String(), nil
+}
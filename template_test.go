@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFormatDiffTemplate(t *testing.T) {
+	path := writeTemplate(t, "report.tmpl", `{{.Baseline.File}} {{.BaselineMeta.ServerURL}} {{len .Changed}}
+{{range .Sections}}{{.Section}}:{{range .Entries}} {{.Field | truncate 12}}={{severity .Field}}{{end}}
+{{end}}{{range .Changed}}{{section .Field}} {{formatValue .Before}} {{json .After}}
+{{end}}`)
+	tmpl, err := LoadReportTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadReportTemplate() error: %v", err)
+	}
+
+	data := NewTemplateData(sampleDiffResult(), &SnapshotMetadata{ServerURL: "https://mm.example.com"}, nil)
+	out, err := FormatDiffTemplate(tmpl, data)
+	if err != nil {
+		t.Fatalf("FormatDiffTemplate() error: %v", err)
+	}
+
+	for _, want := range []string{
+		"baseline.json https://mm.example.com 2\n",
+		"ServiceSettings: ServiceSett…=high ServiceSett…=high\n",
+		`ServiceSettings "" "a|b"`,
+		"ServiceSettings 10 5\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if got := templateContentType(tmpl); got != "text/plain; charset=utf-8" {
+		t.Errorf("content type = %q", got)
+	}
+}
+
+func TestFormatDiffTemplate_HTMLEscapes(t *testing.T) {
+	path := writeTemplate(t, "report.html", `<p>{{range .Changed}}{{formatValue .After}}{{end}}</p>`)
+	tmpl, err := LoadReportTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadReportTemplate() error: %v", err)
+	}
+
+	result := &DiffResult{Changed: []ChangedField{{Field: "ServiceSettings.SiteURL", Before: "", After: "<script>"}}}
+	out, err := FormatDiffTemplate(tmpl, NewTemplateData(result, nil, nil))
+	if err != nil {
+		t.Fatalf("FormatDiffTemplate() error: %v", err)
+	}
+	if strings.Contains(out, "<script>") {
+		t.Errorf("html template should escape values: %s", out)
+	}
+	if got := templateContentType(tmpl); got != "text/html; charset=utf-8" {
+		t.Errorf("content type = %q", got)
+	}
+}
+
+func TestLoadReportTemplate_Errors(t *testing.T) {
+	_, err := LoadReportTemplate(filepath.Join(t.TempDir(), "missing.tmpl"))
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+		t.Errorf("missing file: error = %v, want ExitConfigError", err)
+	} else if !strings.Contains(exitErr.Message, "mattermost.tmpl") {
+		t.Errorf("error should list bundled templates: %s", exitErr.Message)
+	}
+
+	_, err = LoadReportTemplate(writeTemplate(t, "bad.tmpl", "{{.Changed"))
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+		t.Errorf("invalid template: error = %v, want ExitConfigError", err)
+	}
+
+	tmpl, err := LoadReportTemplate(writeTemplate(t, "unknown.tmpl", "{{.NoSuchField}}"))
+	if err != nil {
+		t.Fatalf("LoadReportTemplate() error: %v", err)
+	}
+	_, err = FormatDiffTemplate(tmpl, NewTemplateData(sampleDiffResult(), nil, nil))
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitOutputError {
+		t.Errorf("execution failure: error = %v, want ExitOutputError", err)
+	}
+}
+
+func TestBundledTemplates(t *testing.T) {
+	names := BundledTemplateNames()
+	if len(names) == 0 {
+		t.Fatal("no bundled templates")
+	}
+
+	drift := NewTemplateData(sampleDiffResult(), &SnapshotMetadata{ServerURL: "https://mm.example.com", CapturedAt: "2025-10-01T09:00:00Z"}, nil)
+	none := NewTemplateData(&DiffResult{}, nil, &SnapshotMetadata{ServerURL: "https://mm.example.com"})
+	for _, name := range names {
+		// Bundled templates are found with or without their extension.
+		for _, ref := range []string{name, strings.TrimSuffix(name, filepath.Ext(name))} {
+			tmpl, err := LoadReportTemplate(ref)
+			if err != nil {
+				t.Fatalf("LoadReportTemplate(%q) error: %v", ref, err)
+			}
+			for _, data := range []TemplateData{drift, none} {
+				out, err := FormatDiffTemplate(tmpl, data)
+				if err != nil {
+					t.Errorf("%s: %v", ref, err)
+				}
+				if data.DriftDetected && !strings.Contains(out, "MaximumLoginAttempts") {
+					t.Errorf("%s output missing drift:\n%s", ref, out)
+				}
+			}
+		}
+	}
+
+	// A file takes precedence over a bundled template of the same name.
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile("summary", []byte("local"), 0644)
+	tmpl, _ := LoadReportTemplate("summary")
+	if out, _ := FormatDiffTemplate(tmpl, drift); out != "local" {
+		t.Errorf("output = %q, want the local file", out)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		n    int
+		s    string
+		want string
+	}{
+		{5, "abc", "abc"},
+		{5, "abcde", "abcde"},
+		{5, "abcdef", "abcd…"},
+		{3, "ééééé", "éé…"},
+		{0, "abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.n, tt.s); got != tt.want {
+			t.Errorf("truncate(%d, %q) = %q, want %q", tt.n, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI styles of the text format.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiDim    = "\x1b[2m"
+	ansiDelete = "\x1b[30;41m" // changed characters of a before value
+	ansiInsert = "\x1b[30;42m" // changed characters of an after value
+)
+
+// Side-by-side column sizing.
+const (
+	defaultWidth   = 120
+	minColumnWidth = 20
+)
+
+// textHighlightMinLength is the formatted length from which changed values
+// have their changed characters highlighted, rather than being coloured
+// whole.
+const textHighlightMinLength = 20
+
+// TextOptions control how FormatDiffTextWith renders for a terminal.
+type TextOptions struct {
+	Color      bool
+	SideBySide bool
+	Width      int // terminal width for SideBySide; 0 for defaultWidth
+}
+
+// UseColor resolves a --color mode of "auto", "always" or "never". In auto
+// mode, colour is used when the output is a terminal, unless the NO_COLOR
+// environment variable is set or the terminal is dumb.
+func UseColor(mode string, tty bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		return tty && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb", nil
+	}
+	return false, NewExitError(ExitConfigError, fmt.Sprintf("error: unsupported --color %q. Use 'auto', 'always' or 'never'.", mode), nil)
+}
+
+// StdoutTerminal reports whether stdout is a terminal, and its width.
+func StdoutTerminal() (bool, int) {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return false, 0
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil {
+		return true, 0
+	}
+	return true, width
+}
+
+// textSpan is a run of text in one ANSI style, "" for unstyled.
+type textSpan struct {
+	style string
+	text  string
+}
+
+type painter struct {
+	color bool
+}
+
+func (p painter) paint(style, s string) string {
+	if !p.color || style == "" || s == "" {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+func (p painter) spans(spans []textSpan) string {
+	var sb strings.Builder
+	for _, s := range spans {
+		sb.WriteString(p.paint(s.style, s.text))
+	}
+	return sb.String()
+}
+
+// changeStyles are the colours of each change type.
+var changeStyles = map[string]string{
+	"changed": ansiYellow,
+	"added":   ansiGreen,
+	"removed": ansiRed,
+}
+
+// changedValueSpans renders the before and after values of a changed
+// field. Arrays have their changed items highlighted, and long values
+// their changed characters; shorter values are coloured whole.
+func changedValueSpans(before, after interface{}) ([]textSpan, []textSpan) {
+	if left, right, ok := changedItemSpans(before, after); ok {
+		return left, right
+	}
+	a, b := FormatValue(before), FormatValue(after)
+	if utf8.RuneCountInString(a) >= textHighlightMinLength || utf8.RuneCountInString(b) >= textHighlightMinLength {
+		if diff := diffTokens(strings.Split(a, ""), strings.Split(b, "")); diff != nil {
+			var left, right []textSpan
+			for _, s := range mergeSpans(diff) {
+				switch s.Op {
+				case "same":
+					left = append(left, textSpan{text: s.Text})
+					right = append(right, textSpan{text: s.Text})
+				case "del":
+					left = append(left, textSpan{style: ansiDelete, text: s.Text})
+				default:
+					right = append(right, textSpan{style: ansiInsert, text: s.Text})
+				}
+			}
+			return left, right
+		}
+	}
+	return []textSpan{{style: ansiRed, text: a}}, []textSpan{{style: ansiGreen, text: b}}
+}
+
+// changedItemSpans renders two arrays in JSON notation with the items
+// only one of them has highlighted.
+func changedItemSpans(before, after interface{}) ([]textSpan, []textSpan, bool) {
+	a, okA := before.([]interface{})
+	b, okB := after.([]interface{})
+	if !okA || !okB {
+		return nil, nil, false
+	}
+	diff := diffTokens(formatItems(a), formatItems(b))
+	if diff == nil && len(a)+len(b) > 0 {
+		return nil, nil, false
+	}
+
+	left, right := []textSpan{{text: "["}}, []textSpan{{text: "["}}
+	item := func(spans []textSpan, style, text string) []textSpan {
+		if len(spans) > 1 {
+			spans = append(spans, textSpan{text: ","})
+		}
+		return append(spans, textSpan{style: style, text: text})
+	}
+	for _, s := range diff {
+		switch s.Op {
+		case "same":
+			left, right = item(left, "", s.Text), item(right, "", s.Text)
+		case "del":
+			left = item(left, ansiDelete, s.Text)
+		default:
+			right = item(right, ansiInsert, s.Text)
+		}
+	}
+	return append(left, textSpan{text: "]"}), append(right, textSpan{text: "]"}), true
+}
+
+// sideBySideRows returns the rows of an entry in the side-by-side layout,
+// baseline on the left and compared on the right. Arrays are shown an
+// item per row, with unchanged items aligned.
+func sideBySideRows(e DiffEntry) [][2][]textSpan {
+	before, beforeArray := e.Before.([]interface{})
+	after, afterArray := e.After.([]interface{})
+
+	switch {
+	case e.ChangeType == "changed" && beforeArray && afterArray && (len(before) > 0 || len(after) > 0):
+		var rows [][2][]textSpan
+		for _, s := range diffTokens(formatItems(before), formatItems(after)) {
+			switch s.Op {
+			case "same":
+				rows = append(rows, [2][]textSpan{{{text: s.Text}}, {{text: s.Text}}})
+			case "del":
+				rows = append(rows, [2][]textSpan{{{style: ansiRed, text: s.Text}}, nil})
+			default:
+				rows = append(rows, [2][]textSpan{nil, {{style: ansiGreen, text: s.Text}}})
+			}
+		}
+		if rows != nil {
+			return rows
+		}
+	case e.ChangeType == "added" && afterArray && len(after) > 0:
+		var rows [][2][]textSpan
+		for _, item := range formatItems(after) {
+			rows = append(rows, [2][]textSpan{nil, {{style: ansiGreen, text: item}}})
+		}
+		return rows
+	case e.ChangeType == "removed" && beforeArray && len(before) > 0:
+		var rows [][2][]textSpan
+		for _, item := range formatItems(before) {
+			rows = append(rows, [2][]textSpan{{{style: ansiRed, text: item}}, nil})
+		}
+		return rows
+	}
+
+	switch e.ChangeType {
+	case "added":
+		return [][2][]textSpan{{nil, {{style: ansiGreen, text: FormatValue(e.After)}}}}
+	case "removed":
+		return [][2][]textSpan{{{{style: ansiRed, text: FormatValue(e.Before)}}, nil}}
+	}
+	left, right := changedValueSpans(e.Before, e.After)
+	return [][2][]textSpan{{left, right}}
+}
+
+// wrapSpans breaks spans into lines of at most width characters.
+func wrapSpans(spans []textSpan, width int) [][]textSpan {
+	lines := [][]textSpan{nil}
+	n := 0
+	for _, s := range spans {
+		text := s.text
+		for text != "" {
+			if n == width {
+				lines = append(lines, nil)
+				n = 0
+			}
+			i, count := 0, 0
+			for i < len(text) && n+count < width {
+				_, size := utf8.DecodeRuneInString(text[i:])
+				i += size
+				count++
+			}
+			lines[len(lines)-1] = append(lines[len(lines)-1], textSpan{style: s.style, text: text[:i]})
+			text = text[i:]
+			n += count
+		}
+	}
+	return lines
+}
+
+func spansWidth(spans []textSpan) int {
+	n := 0
+	for _, s := range spans {
+		n += utf8.RuneCountInString(s.text)
+	}
+	return n
+}
+
+// writeSideBySide writes the changed, added and removed fields with their
+// baseline and compared values in two columns fitting width.
+func writeSideBySide(sb *strings.Builder, result *DiffResult, p painter, width int) {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	const indent, separator = "    ", " │ "
+	column := (width - len(indent) - utf8.RuneCountInString(separator)) / 2
+	if column < minColumnWidth {
+		column = minColumnWidth
+	}
+	pad := func(spans []textSpan) string {
+		return p.spans(spans) + strings.Repeat(" ", column-spansWidth(spans))
+	}
+
+	sb.WriteString(indent + p.paint(ansiBold, fmt.Sprintf("%-*s", column, "Baseline")) + separator + p.paint(ansiBold, "Compared") + "\n\n")
+
+	entries := result.Entries()
+	for _, changeType := range []string{"changed", "added", "removed"} {
+		var group []DiffEntry
+		for _, e := range entries {
+			if e.ChangeType == changeType {
+				group = append(group, e)
+			}
+		}
+		style := changeStyles[changeType]
+		sb.WriteString(p.paint(ansiBold+style, fmt.Sprintf("%s (%d):", strings.ToUpper(changeType), len(group))) + "\n")
+		if len(group) == 0 {
+			sb.WriteString("  (none)\n\n")
+			continue
+		}
+		for _, e := range group {
+			sb.WriteString("  " + p.paint(style, e.Field) + "\n")
+			for _, row := range sideBySideRows(e) {
+				left, right := wrapSpans(row[0], column), wrapSpans(row[1], column)
+				for i := 0; i < len(left) || i < len(right); i++ {
+					var l, r []textSpan
+					if i < len(left) {
+						l = left[i]
+					}
+					if i < len(right) {
+						r = right[i]
+					}
+					sb.WriteString(strings.TrimRight(indent+pad(l)+separator+p.spans(r), " ") + "\n")
+				}
+			}
+			sb.WriteString("\n")
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		mode    string
+		tty     bool
+		noColor string
+		want    bool
+	}{
+		{"auto", true, "", true},
+		{"auto", false, "", false},
+		{"auto", true, "1", false},
+		{"always", false, "1", true},
+		{"never", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		t.Setenv("TERM", "xterm-256color")
+		got, err := UseColor(tt.mode, tt.tty)
+		if err != nil || got != tt.want {
+			t.Errorf("UseColor(%q, %v) with NO_COLOR=%q = %v, %v; want %v", tt.mode, tt.tty, tt.noColor, got, err, tt.want)
+		}
+	}
+
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "dumb")
+	if got, _ := UseColor("auto", true); got {
+		t.Error("auto should not colour a dumb terminal")
+	}
+
+	_, err := UseColor("sometimes", true)
+	if err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.Code != ExitConfigError {
+		t.Errorf("error = %v, want ExitConfigError", err)
+	}
+}
+
+func TestFormatDiffTextWith_Color(t *testing.T) {
+	result := sampleDiffResult()
+	result.Changed = append(result.Changed, ChangedField{
+		Field:  "ServiceSettings.SiteURL",
+		Before: "https://mm.example.com/teams/engineering",
+		After:  "https://chat.example.com/teams/engineering",
+	})
+
+	out := FormatDiffTextWith(result, TextOptions{Color: true})
+	for _, want := range []string{
+		ansiBold + ansiYellow + "CHANGED (3):" + ansiReset,
+		ansiBold + ansiGreen + "ADDED (1):" + ansiReset,
+		ansiBold + ansiRed + "REMOVED (1):" + ansiReset,
+		// Short values are coloured whole.
+		"Before : " + ansiRed + "10" + ansiReset,
+		"After  : " + ansiGreen + "5" + ansiReset,
+		// Long strings have their changed characters highlighted.
+		`Before : "https://` + ansiDelete + "mm" + ansiReset + `.example.com/teams/engineering"`,
+		`After  : "https://` + ansiInsert + "chat" + ansiReset + `.example.com/teams/engineering"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Without colours the text is the plain format.
+	if plain := ansiPattern.ReplaceAllString(out, ""); plain != FormatDiffText(result) {
+		t.Errorf("colour output differs from plain text once colours are removed:\n%s", plain)
+	}
+	if out := FormatDiffTextWith(result, TextOptions{}); strings.Contains(out, "\x1b[") {
+		t.Errorf("uncoloured output has escape codes:\n%s", out)
+	}
+}
+
+func TestChangedValueSpans_Arrays(t *testing.T) {
+	left, right := changedValueSpans(
+		[]interface{}{"com.a", "com.b", "com.c"},
+		[]interface{}{"com.a", "com.c", "com.d"},
+	)
+	p := painter{color: true}
+	if got, want := p.spans(left), `["com.a",`+ansiDelete+`"com.b"`+ansiReset+`,"com.c"]`; got != want {
+		t.Errorf("before = %q, want %q", got, want)
+	}
+	if got, want := p.spans(right), `["com.a","com.c",`+ansiInsert+`"com.d"`+ansiReset+`]`; got != want {
+		t.Errorf("after = %q, want %q", got, want)
+	}
+}
+
+func TestFormatDiffTextWith_SideBySide(t *testing.T) {
+	result := sampleDiffResult()
+	result.Changed = append(result.Changed, ChangedField{
+		Field:  "ServiceSettings.SiteURL",
+		Before: strings.Repeat("a", 50),
+		After:  strings.Repeat("b", 50),
+	})
+	result.Added = append(result.Added, AddedField{Field: "ServiceSettings.ListenAddress", Value: ":8065"})
+
+	out := FormatDiffTextWith(result, TextOptions{SideBySide: true, Width: 60})
+	if normal := FormatDiffTextWith(result, TextOptions{}); strings.HasSuffix(out, "\n") != strings.HasSuffix(normal, "\n") {
+		t.Errorf("side-by-side and normal output end differently: %q vs %q", out[len(out)-1:], normal[len(normal)-1:])
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if n := utf8.RuneCountInString(line); strings.Contains(line, "│") && n > 60 {
+			t.Errorf("line of %d characters exceeds width:\n%s", n, line)
+		}
+	}
+
+	for _, want := range []string{
+		"    Baseline                   │ Compared",
+		"    10                         │ 5",
+		"                               │ \":8065\"",
+		// Removed values are on the baseline side only.
+		"    \"town-square\"              │",
+		// Long values wrap within their column.
+		"    \"aaaaaaaaaaaaaaaaaaaaaaaaa │ \"bbbbbbbbbbbbbbbbbbbbbbbbb",
+		"    aaaaaaaaaaaaaaaaaaaaaaaaa\" │ bbbbbbbbbbbbbbbbbbbbbbbbb\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	colored := FormatDiffTextWith(result, TextOptions{SideBySide: true, Width: 60, Color: true})
+	if plain := ansiPattern.ReplaceAllString(colored, ""); plain != out {
+		t.Errorf("colour changes the side-by-side layout:\n%s", plain)
+	}
+}
+
+func TestSideBySideRows_Arrays(t *testing.T) {
+	rows := sideBySideRows(DiffEntry{
+		Field:      "PluginSettings.PluginStates",
+		ChangeType: "changed",
+		Before:     []interface{}{"a", "b", "c"},
+		After:      []interface{}{"a", "c", "d"},
+	})
+	var got []string
+	for _, row := range rows {
+		got = append(got, painter{}.spans(row[0])+"|"+painter{}.spans(row[1]))
+	}
+	if want := `"a"|"a" "b"| "c"|"c" |"d"`; strings.Join(got, " ") != want {
+		t.Errorf("rows = %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestWrapSpans(t *testing.T) {
+	lines := wrapSpans([]textSpan{{text: "abc"}, {style: ansiRed, text: "défgh"}}, 3)
+	var got []string
+	for _, line := range lines {
+		got = append(got, painter{}.spans(line))
+	}
+	if strings.Join(got, "|") != "abc|déf|gh" {
+		t.Errorf("lines = %q", got)
+	}
+	if lines[1][0].style != ansiRed {
+		t.Errorf("wrapped span lost its style: %+v", lines[1])
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+	maxRetryAfter         = 2 * time.Minute
+)
+
+// TLSOptions configure server verification and client certificates.
+type TLSOptions struct {
+	CAFile             string // PEM bundle of CAs trusted in addition to the system pool
+	CertFile           string // PEM client certificate for mutual TLS
+	KeyFile            string // PEM private key for CertFile
+	InsecureSkipVerify bool
+}
+
+// newHTTPTransport builds the base transport for API requests from the TLS
+// and proxy options. Without a proxy URL, the standard HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables apply.
+func newHTTPTransport(tlsOpts TLSOptions, proxyURL string) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+	tr.TLSClientConfig = tlsConfig
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: invalid proxy URL %q", proxyURL), err)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	return tr, nil
+}
+
+// newTLSConfig builds a client TLS configuration from the TLS options.
+func newTLSConfig(tlsOpts TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsOpts.CAFile != "" {
+		pem, err := os.ReadFile(tlsOpts.CAFile)
+		if err != nil {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: unable to read CA bundle %s", tlsOpts.CAFile), err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: CA bundle %s contains no PEM certificates", tlsOpts.CAFile), nil)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if (tlsOpts.CertFile == "") != (tlsOpts.KeyFile == "") {
+		return nil, NewExitError(ExitConfigError, "error: --client-cert and --client-key must be used together.", nil)
+	}
+	if tlsOpts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsOpts.CertFile, tlsOpts.KeyFile)
+		if err != nil {
+			return nil, NewExitError(ExitConfigError, "error: unable to load client certificate", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if tlsOpts.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// ParseHeaders parses "Name: value" request header flags.
+func ParseHeaders(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, NewExitError(ExitConfigError, fmt.Sprintf("error: invalid header %q. Use \"Name: value\".", v), nil)
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if name == "Authorization" {
+			return nil, NewExitError(ExitConfigError, "error: --header cannot set Authorization, which carries the Mattermost session. Use --token instead.", nil)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// retryTransport retries requests that fail with connection errors, 5xx
+// responses or 429 Too Many Requests, using exponential backoff with
+// jitter. A Retry-After header on a 429 or 503 response takes precedence
+// over the computed backoff. Each attempt is bounded by timeout.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	timeout    time.Duration
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	verbose    bool
+
+	// sleep waits for d or until ctx is done; replaceable in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryTransport(base http.RoundTripper, maxRetries int, timeout time.Duration, verbose bool) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	return &retryTransport{
+		base:       base,
+		maxRetries: maxRetries,
+		timeout:    timeout,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   defaultRetryMaxDelay,
+		verbose:    verbose,
+		sleep:      sleepContext,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewindRequest(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.roundTripOnce(attemptReq)
+
+		retry, reason := t.shouldRetry(req, resp, err)
+		if !retry || attempt >= t.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if after > maxRetryAfter {
+					return resp, err
+				}
+				delay = after
+			}
+			drainAndClose(resp.Body)
+		}
+
+		if t.verbose {
+			fmt.Fprintf(os.Stderr, "Retrying %s %s in %s (attempt %d of %d): %s\n",
+				req.Method, req.URL.Path, delay.Round(time.Millisecond), attempt+2, t.maxRetries+1, reason)
+		}
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTripOnce sends a single attempt, bounded by the per-attempt timeout.
+// The timeout stays in force while the response body is read.
+func (t *retryTransport) roundTripOnce(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			return nil, fmt.Errorf("request timed out after %s: %w", t.timeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// shouldRetry reports whether an attempt's outcome is worth retrying, and why.
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) (bool, string) {
+	if err != nil {
+		// The caller's own cancellation is final.
+		if req.Context().Err() != nil {
+			return false, ""
+		}
+		return isIdempotent(req.Method), err.Error()
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// The server did not process the request, so any method may retry.
+		return true, "HTTP 429 Too Many Requests"
+	case resp.StatusCode >= 500:
+		return isIdempotent(req.Method), fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return false, ""
+}
+
+// backoff returns the delay before retry number attempt+1: exponential in
+// the attempt number, capped at maxDelay, with equal jitter.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	d := t.baseDelay << attempt
+	if d <= 0 || d > t.maxDelay {
+		d = t.maxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// rewindRequest clones req with a fresh body for another attempt.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("cannot retry %s %s: request body is not replayable", req.Method, req.URL.Path)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
+
+// parseRetryAfter parses a Retry-After value given in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := when.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 64*1024))
+	body.Close()
+}
+
+// cancelOnClose releases a per-attempt context once the body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
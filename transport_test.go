@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestRetryTransport returns a retryTransport that records its delays
+// instead of sleeping.
+func newTestRetryTransport(maxRetries int, timeout time.Duration) (*retryTransport, *[]time.Duration) {
+	var delays []time.Duration
+	rt := newRetryTransport(nil, maxRetries, timeout, false)
+	rt.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+	return rt, &delays
+}
+
+func TestRetryTransport_RetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	rt, delays := newTestRetryTransport(3, 0)
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q", resp.StatusCode, body)
+	}
+	if calls != 3 || len(*delays) != 2 {
+		t.Errorf("calls = %d, delays = %v", calls, *delays)
+	}
+}
+
+func TestRetryTransport_GivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	rt, _ := newTestRetryTransport(2, 0)
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != 3 {
+		t.Errorf("status = %d, calls = %d", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryTransport_HonoursRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	rt, delays := newTestRetryTransport(3, 0)
+	// A 429 is retried even for POST, with the body replayed.
+	resp, err := (&http.Client{Transport: rt}).Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "payload" {
+		t.Errorf("replayed body = %q", body)
+	}
+	if len(*delays) != 1 || (*delays)[0] != 7*time.Second {
+		t.Errorf("delays = %v, want [7s]", *delays)
+	}
+}
+
+func TestRetryTransport_DoesNotRetryPostOnServerError(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	rt, _ := newTestRetryTransport(3, 0)
+	resp, err := (&http.Client{Transport: rt}).Post(server.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("Post failed: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("POST was sent %d times", calls)
+	}
+}
+
+func TestRetryTransport_RetriesConnectionErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	rt, delays := newTestRetryTransport(2, 0)
+	_, err := (&http.Client{Transport: rt}).Get(url)
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+	if len(*delays) != 2 {
+		t.Errorf("delays = %v, want 2 retries", *delays)
+	}
+}
+
+func TestRetryTransport_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	rt, delays := newTestRetryTransport(1, 50*time.Millisecond)
+	_, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("error = %v", err)
+	}
+	if len(*delays) != 1 {
+		t.Errorf("timed-out request should be retried once, delays = %v", *delays)
+	}
+}
+
+func TestRetryTransport_StopsOnCancellation(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := newRetryTransport(nil, 5, 0, false)
+	rt.sleep = func(context.Context, time.Duration) error {
+		cancel()
+		return context.Canceled
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	_, err := (&http.Client{Transport: rt}).Do(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryTransport_Backoff(t *testing.T) {
+	rt := newRetryTransport(nil, 10, 0, false)
+	for attempt := 0; attempt < 10; attempt++ {
+		d := rt.backoff(attempt)
+		ceiling := rt.baseDelay << attempt
+		if ceiling > rt.maxDelay {
+			ceiling = rt.maxDelay
+		}
+		if d < ceiling/2 || d > ceiling {
+			t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, d, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 10, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"Wed, 01 Oct 2025 09:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 Oct 2025 08:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNewLiveClient_RetriesGetConfig(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{"ServiceSettings":{"SiteURL":"https://mm.example.com"}}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := NewLiveClient(ctx, server.URL, Credentials{Token: StaticCredential{Value: "token"}}, LiveClientOptions{Timeout: time.Second, MaxRetries: 1})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	config, err := client.GetConfig(ctx)
+	if err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+	if config["ServiceSettings"] == nil || calls != 2 {
+		t.Errorf("config = %v, calls = %d", config, calls)
+	}
+}
+
+// testCA issues certificates for TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for a server or client.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewHTTPTransport_MutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	pair, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	opts := TLSOptions{
+		CAFile:   writeTestFile(t, dir, "ca.pem", ca.pem),
+		CertFile: writeTestFile(t, dir, "client.pem", clientCert),
+		KeyFile:  writeTestFile(t, dir, "client-key.pem", clientKey),
+	}
+
+	tr, err := newHTTPTransport(opts, "")
+	if err != nil {
+		t.Fatalf("newHTTPTransport failed: %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "client" {
+		t.Errorf("server saw client %q", body)
+	}
+
+	// Without the client certificate the handshake is rejected.
+	tr, _ = newHTTPTransport(TLSOptions{CAFile: opts.CAFile}, "")
+	if _, err := (&http.Client{Transport: tr}).Get(server.URL); err == nil {
+		t.Error("expected handshake failure without a client certificate")
+	}
+}
+
+func TestNewHTTPTransport_Verification(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	tr, _ := newHTTPTransport(TLSOptions{}, "")
+	if _, err := (&http.Client{Transport: tr}).Get(server.URL); err == nil {
+		t.Error("expected certificate verification failure")
+	}
+
+	tr, _ = newHTTPTransport(TLSOptions{InsecureSkipVerify: true}, "")
+	resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("insecure request failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPTransport_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := writeTestFile(t, dir, "bundle.txt", []byte("not a certificate"))
+
+	tests := []struct {
+		name  string
+		opts  TLSOptions
+		proxy string
+	}{
+		{"missing CA file", TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, ""},
+		{"CA file without certificates", TLSOptions{CAFile: notPEM}, ""},
+		{"cert without key", TLSOptions{CertFile: notPEM}, ""},
+		{"unparseable key pair", TLSOptions{CertFile: notPEM, KeyFile: notPEM}, ""},
+		{"bad proxy", TLSOptions{}, "::not a url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHTTPTransport(tt.opts, tt.proxy)
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != ExitConfigError {
+				t.Errorf("expected config error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewLiveClient_ProxyAndHeaders(t *testing.T) {
+	var seen *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+		io.WriteString(w, `{"ServiceSettings":{}}`)
+	}))
+	defer proxy.Close()
+
+	headers, err := ParseHeaders([]string{"x-proxy-user: ops", "X-Team:  platform "})
+	if err != nil {
+		t.Fatalf("ParseHeaders failed: %v", err)
+	}
+	ctx := context.Background()
+	client, err := NewLiveClient(ctx, "http://mm.internal.example", Credentials{Token: StaticCredential{Value: "token"}}, LiveClientOptions{
+		ProxyURL: proxy.URL,
+		Headers:  headers,
+	})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	if _, err := client.GetConfig(ctx); err != nil {
+		t.Fatalf("GetConfig failed: %v", err)
+	}
+
+	if seen == nil || seen.URL.Host != "mm.internal.example" {
+		t.Fatalf("request did not go through the proxy: %+v", seen)
+	}
+	if seen.Header.Get("X-Proxy-User") != "ops" || seen.Header.Get("X-Team") != "platform" {
+		t.Errorf("extra headers missing: %v", seen.Header)
+	}
+	if !strings.EqualFold(seen.Header.Get("Authorization"), "Bearer token") {
+		t.Errorf("Authorization = %q", seen.Header.Get("Authorization"))
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	for _, bad := range []string{"no-colon", ": value", "Bad Name: x", "authorization: Bearer x"} {
+		if _, err := ParseHeaders([]string{bad}); err == nil {
+			t.Errorf("ParseHeaders(%q) should fail", bad)
+		}
+	}
+	headers, err := ParseHeaders([]string{"X-Empty:"})
+	if err != nil || headers["X-Empty"] != "" {
+		t.Errorf("empty value: %v, %v", headers, err)
+	}
+}
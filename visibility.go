@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// permissionReader is implemented by clients whose account may hold only
+// granular sysconsole_read_* permissions, for which the server returns a
+// config with the unreadable settings left out.
+type permissionReader interface {
+	ReadPermissions(ctx context.Context) (map[string]bool, error)
+}
+
+// ReadPermissions returns the permissions of the authenticated account,
+// or nil if it can read the whole configuration.
+func (c *LiveClient) ReadPermissions(ctx context.Context) (map[string]bool, error) {
+	return readPermissions(ctx, c.client, c.serverURL)
+}
+
+func readPermissions(ctx context.Context, client *model.Client4, serverURL string) (map[string]bool, error) {
+	user, resp, err := client.GetMe(ctx, "")
+	if err != nil {
+		return nil, ClassifyAPIError(responseStatus(resp), serverURL, err)
+	}
+	roleNames := strings.Fields(user.Roles)
+	for _, role := range roleNames {
+		if role == model.SystemAdminRoleId {
+			return nil, nil
+		}
+	}
+
+	roles, resp, err := client.GetRolesByNames(ctx, roleNames)
+	if err != nil {
+		return nil, ClassifyAPIError(responseStatus(resp), serverURL, err)
+	}
+	permissions := make(map[string]bool)
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			permissions[p] = true
+		}
+	}
+	if permissions[model.PermissionManageSystem.Id] {
+		return nil, nil
+	}
+	return permissions, nil
+}
+
+func responseStatus(resp *model.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+var (
+	accessTagsOnce sync.Once
+	accessTags     map[string][]string
+)
+
+// configAccessTags returns the access tags of every setting of this
+// build's model.Config, by dot-notation path. The server lets an account
+// without manage_system read a setting when it holds sysconsole_read_<tag>
+// for one of its tags.
+func configAccessTags() map[string][]string {
+	accessTagsOnce.Do(func() {
+		accessTags = make(map[string][]string)
+		collectAccessTags(reflect.TypeOf(model.Config{}), "", accessTags)
+	})
+	return accessTags
+}
+
+func collectAccessTags(t reflect.Type, prefix string, tags map[string][]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		// As on the server, struct fields are filtered field by field.
+		if field.Type.Kind() == reflect.Struct {
+			collectAccessTags(field.Type, path, tags)
+			continue
+		}
+		tags[path] = strings.Split(field.Tag.Get(model.ConfigAccessTagType), ",")
+	}
+}
+
+// canReadSetting reports whether permissions let an account read a setting
+// with the given access tags, following the server's config filter.
+func canReadSetting(tags []string, permissions map[string]bool) bool {
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "":
+		case tag == model.ConfigAccessTagAnySysConsoleRead:
+			for p := range permissions {
+				if strings.HasPrefix(p, "sysconsole_read_") {
+					return true
+				}
+			}
+		case permissions["sysconsole_read_"+tag]:
+			return true
+		}
+	}
+	return false
+}
+
+// FilterHiddenFields handles a config the server filtered by the reader's
+// sysconsole_read permissions. A setting is hidden when the permissions do
+// not cover its access tags and the response holds no value for it; the
+// server leaves such settings out, and they come back as nulls or zero
+// values once decoded into model.Config. Hidden settings are removed,
+// along with sections left empty. It returns the sections still present
+// in full, and whether any setting was hidden.
+func FilterHiddenFields(config map[string]interface{}, permissions map[string]bool) ([]string, bool) {
+	hidden := make(map[string]bool)
+	for path, tags := range configAccessTags() {
+		if canReadSetting(tags, permissions) {
+			continue
+		}
+		if removeUnsetSetting(config, strings.Split(path, ".")) {
+			hidden[configSection(path)] = true
+		}
+	}
+
+	var visible []string
+	for section := range StripMetadata(config) {
+		if !hidden[section] {
+			visible = append(visible, section)
+		}
+	}
+	sort.Strings(visible)
+	return visible, len(hidden) > 0
+}
+
+// removeUnsetSetting removes the setting at path if it is missing, null or
+// a zero value, and any maps emptied by doing so. It reports whether the
+// setting was unset.
+func removeUnsetSetting(m map[string]interface{}, path []string) bool {
+	v, ok := m[path[0]]
+	if len(path) > 1 {
+		child, isMap := v.(map[string]interface{})
+		if !ok || v == nil {
+			delete(m, path[0])
+			return true
+		}
+		if !isMap {
+			return false
+		}
+		unset := removeUnsetSetting(child, path[1:])
+		if len(child) == 0 {
+			delete(m, path[0])
+		}
+		return unset
+	}
+	if ok && !isZeroValue(v) {
+		return false
+	}
+	delete(m, path[0])
+	return true
+}
+
+// isZeroValue reports whether a decoded JSON value is null or the zero
+// value of its type.
+func isZeroValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case float64:
+		return val == 0
+	case bool:
+		return !val
+	case map[string]interface{}:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+// sectionVisibility returns a function reporting whether a section was
+// visible when the snapshot was captured. Snapshots not marked partial
+// were captured with full access.
+func sectionVisibility(config map[string]interface{}) func(section string) bool {
+	meta, _ := config["_metadata"].(map[string]interface{})
+	if meta["partial"] != true {
+		return func(string) bool { return true }
+	}
+	sections, _ := meta["visible_sections"].([]interface{})
+	visible := make(map[string]bool, len(sections))
+	for _, s := range sections {
+		if name, ok := s.(string); ok {
+			visible[name] = true
+		}
+	}
+	return func(section string) bool { return visible[section] }
+}
+
+// configSection returns the top-level section of a dot-notation path.
+func configSection(path string) string {
+	section, _, _ := strings.Cut(path, ".")
+	return section
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// defaultConfigMap returns the server's default config as a generic map.
+func defaultConfigMap(t *testing.T) map[string]interface{} {
+	t.Helper()
+	cfg := &model.Config{}
+	cfg.SetDefaults()
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// sysconsoleReadPermissions returns every sysconsole_read_* permission,
+// as held by the System Read-only Admin role.
+func sysconsoleReadPermissions() map[string]bool {
+	permissions := make(map[string]bool)
+	for _, p := range model.SysconsoleReadPermissions {
+		permissions[p.Id] = true
+	}
+	return permissions
+}
+
+func TestFilterHiddenFields_ReadableNullIsKept(t *testing.T) {
+	// A null setting the account may read is the server's own value, for
+	// example a setting newer than the server, and not a hidden one.
+	config := defaultConfigMap(t)
+	sql := config["SqlSettings"].(map[string]interface{})
+	sql["DriverName"] = nil
+
+	visible, _ := FilterHiddenFields(config, sysconsoleReadPermissions())
+	if v, ok := sql["DriverName"]; !ok || v != nil {
+		t.Errorf("DriverName = %v, %v; want a kept null", v, ok)
+	}
+	if !strings.Contains(strings.Join(visible, ","), "SqlSettings") {
+		t.Errorf("visible = %v, want SqlSettings", visible)
+	}
+}
+
+func TestFilterHiddenFields_Filtered(t *testing.T) {
+	// The server nulls out the settings the permissions do not cover.
+	permissions := map[string]bool{"sysconsole_read_site_users_and_teams": true}
+	config := defaultConfigMap(t)
+	for path, tags := range configAccessTags() {
+		if path != "LogSettings.ConsoleLevel" && !canReadSetting(tags, permissions) {
+			setPath(config, path, nil)
+		}
+	}
+
+	visible, partial := FilterHiddenFields(config, permissions)
+	if !partial {
+		t.Fatal("expected partial visibility")
+	}
+	if !reflect.DeepEqual(visible, []string{"FeatureFlags", "PrivacySettings"}) {
+		t.Errorf("visible = %v", visible)
+	}
+	if _, ok := config["SqlSettings"]; ok {
+		t.Error("a wholly filtered section should be removed")
+	}
+	service := config["ServiceSettings"].(map[string]interface{})
+	if _, ok := service["SiteURL"]; ok {
+		t.Error("a filtered setting should be removed")
+	}
+	if _, ok := service["EnableCustomGroups"]; !ok {
+		t.Error("a readable setting should be kept")
+	}
+	if level := config["LogSettings"].(map[string]interface{})["ConsoleLevel"]; level != "DEBUG" {
+		t.Errorf("ConsoleLevel = %v; a value the server returned should be kept", level)
+	}
+}
+
+// setPath sets the value at a dot-notation path of a config map.
+func setPath(config map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	m := config
+	for _, k := range keys[:len(keys)-1] {
+		child, ok := m[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = value
+}
+
+// serveRestrictedConfig serves a config containing only the given
+// sections to a user with the given roles, which together hold the given
+// permissions.
+func serveRestrictedConfig(t *testing.T, roles string, permissions map[string]bool, sections ...string) *httptest.Server {
+	t.Helper()
+	defaults := defaultConfigMap(t)
+	config := make(map[string]interface{})
+	for _, section := range sections {
+		config[section] = defaults[section]
+	}
+	body, _ := json.Marshal(config)
+	var held []string
+	for p := range permissions {
+		held = append(held, p)
+	}
+	roleBody, _ := json.Marshal([]*model.Role{{Name: "custom_auditor", Permissions: held}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/users/me":
+			io.WriteString(w, `{"id":"u1","username":"auditor","roles":"`+roles+`"}`)
+		case "/api/v4/roles/names":
+			w.Write(roleBody)
+		case "/api/v4/config":
+			w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// teamSettingsPermissions cover every setting in TeamSettings.
+var teamSettingsPermissions = map[string]bool{
+	"sysconsole_read_site_customization":                   true,
+	"sysconsole_read_site_notifications":                   true,
+	"sysconsole_read_site_users_and_teams":                 true,
+	"sysconsole_read_authentication_signup":                true,
+	"sysconsole_read_experimental_features":                true,
+	"sysconsole_read_environment_push_notification_server": true,
+}
+
+func TestTakeSnapshot_RecordsVisibleSections(t *testing.T) {
+	server := serveRestrictedConfig(t, "system_user custom_auditor", teamSettingsPermissions, "TeamSettings")
+	client, err := NewLiveClient(context.Background(), server.URL, Credentials{Token: StaticCredential{Value: "tok"}}, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	snapshot, err := TakeSnapshot(context.Background(), client, "1.0.0")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	meta, err := snapshotMetadata(snapshot, "snapshot")
+	if err != nil {
+		t.Fatalf("snapshotMetadata failed: %v", err)
+	}
+	visible := strings.Join(meta.VisibleSections, ",")
+	if !strings.Contains(visible, "TeamSettings") || strings.Contains(visible, "ServiceSettings") {
+		t.Errorf("VisibleSections = %v", meta.VisibleSections)
+	}
+	if _, ok := snapshot["SqlSettings"]; ok {
+		t.Error("an unreadable section should be left out of the snapshot")
+	}
+}
+
+func TestTakeSnapshot_NoReadableSections(t *testing.T) {
+	// An account that can read no section in full is still partial, so
+	// that a diff does not report its hidden settings as removed.
+	server := serveRestrictedConfig(t, "system_user custom_auditor", map[string]bool{"view_members": true})
+	client, err := NewLiveClient(context.Background(), server.URL, Credentials{Token: StaticCredential{Value: "tok"}}, LiveClientOptions{})
+	if err != nil {
+		t.Fatalf("NewLiveClient failed: %v", err)
+	}
+	snapshot, err := TakeSnapshot(context.Background(), client, "1.0.0")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	meta, _ := snapshotMetadata(snapshot, "snapshot")
+	if !meta.Partial || len(meta.VisibleSections) != 0 {
+		t.Errorf("Partial = %v, VisibleSections = %v", meta.Partial, meta.VisibleSections)
+	}
+
+	baseline := defaultConfigMap(t)
+	result := CompareConfigs(baseline, snapshot, nil)
+	if len(result.Removed) != 0 || len(result.NotVisible) == 0 {
+		t.Errorf("removed = %d, not visible = %d; want every setting not visible", len(result.Removed), len(result.NotVisible))
+	}
+}
+
+func TestTakeSnapshot_SystemAdminIsNotChecked(t *testing.T) {
+	// An admin's config can lack settings newer than the server, which
+	// must not be mistaken for filtering.
+	server := serveRestrictedConfig(t, "system_user system_admin", nil, "TeamSettings")
+	client, _ := NewLiveClient(context.Background(), server.URL, Credentials{Token: StaticCredential{Value: "tok"}}, LiveClientOptions{})
+	snapshot, err := TakeSnapshot(context.Background(), client, "1.0.0")
+	if err != nil {
+		t.Fatalf("TakeSnapshot failed: %v", err)
+	}
+	meta, _ := snapshotMetadata(snapshot, "snapshot")
+	if meta.Partial || len(meta.VisibleSections) != 0 {
+		t.Errorf("Partial = %v, VisibleSections = %v, want full access for a system admin", meta.Partial, meta.VisibleSections)
+	}
+}
+
+func TestFormatDiffText_NotVisible(t *testing.T) {
+	result := &DiffResult{
+		DriftDetected: true,
+		Changed:       []ChangedField{{Field: "TeamSettings.MaxUsersPerTeam", Before: float64(50), After: float64(100)}},
+		NotVisible:    []NotVisibleField{{Field: "SqlSettings.DriverName", Value: "postgres", HiddenIn: "compared"}},
+	}
+	out := FormatDiffText(result)
+	if !strings.Contains(out, "NOT VISIBLE (1):") || !strings.Contains(out, "SqlSettings.DriverName : \"postgres\" (not readable in compared)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	result = &DiffResult{NotVisible: result.NotVisible}
+	if out := FormatDiffText(result); !strings.Contains(out, "1 field(s) were not compared") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
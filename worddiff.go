@@ -0,0 +1,76 @@
+package main
+
+// maxDiffCells bounds the work of diffing two long values.
+const maxDiffCells = 1 << 20
+
+// DiffSpan is a run of a value diff: unchanged, deleted or inserted.
+type DiffSpan struct {
+	Op   string // "same", "del" or "ins"
+	Text string
+}
+
+func formatItems(items []interface{}) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = FormatValue(item)
+	}
+	return result
+}
+
+// diffTokens returns a longest-common-subsequence diff of two token lists.
+func diffTokens(a, b []string) []DiffSpan {
+	if len(a)*len(b) > maxDiffCells {
+		return nil
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var spans []DiffSpan
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			spans = append(spans, DiffSpan{Op: "same", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			spans = append(spans, DiffSpan{Op: "del", Text: a[i]})
+			i++
+		default:
+			spans = append(spans, DiffSpan{Op: "ins", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		spans = append(spans, DiffSpan{Op: "del", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		spans = append(spans, DiffSpan{Op: "ins", Text: b[j]})
+	}
+	return spans
+}
+
+// mergeSpans joins adjacent spans of the same kind.
+func mergeSpans(spans []DiffSpan) []DiffSpan {
+	var merged []DiffSpan
+	for _, s := range spans {
+		if n := len(merged); n > 0 && merged[n-1].Op == s.Op {
+			merged[n-1].Text += s.Text
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}